@@ -0,0 +1,492 @@
+package jsonapi
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// typePlans caches the compiled *typePlan of every struct type that has
+	// been marshaled or unmarshaled, keyed by reflect.Type.
+	typePlans sync.Map
+	// choicePlans caches the compiled *choicePlan of every polyrelation choice
+	// type struct, keyed by reflect.Type.
+	choicePlans sync.Map
+
+	timeType    = reflect.TypeOf(time.Time{})
+	timePtrType = reflect.TypeOf(new(time.Time))
+)
+
+// fieldPlan is the compiled form of a single jsonapi annotated struct field.
+// It is computed once per struct type and shared by the marshal and unmarshal
+// paths so that struct tags are not re-parsed for every node.
+type fieldPlan struct {
+	// structField is the reflected struct field the plan was compiled from.
+	structField reflect.StructField
+	// index is the index sequence of the field within its struct, as used by
+	// reflect.Value.FieldByIndex. It has more than one element for fields
+	// promoted from embedded structs.
+	index []int
+	// annotation is the first tag value, e.g. "attr" or "relation".
+	annotation string
+	// name is the member name of the field, e.g. the attribute or
+	// relationship key or the primary type. It is empty for client-id fields.
+	name string
+
+	omitEmpty bool
+	iso8601   bool
+	rfc3339   bool
+	// merge is set for nested attribute structs whose members UnmarshalPatch
+	// merges into the struct the model holds, rather than replacing it.
+	merge bool
+
+	// kind is the reflect.Kind of the field type, after dereferencing a
+	// pointer.
+	kind reflect.Kind
+
+	isSlice                bool
+	isNullableAttr         bool
+	isNullableRelationship bool
+	// isToOne and isToMany are set for relation fields holding a ToOne or a
+	// ToMany.
+	isToOne  bool
+	isToMany bool
+
+	// isTime and isTimePtr are set for attribute fields whose value, after
+	// unwrapping a NullableAttr, is a time.Time or a *time.Time.
+	isTime    bool
+	isTimePtr bool
+
+	// nested is set for attribute fields holding a struct, a struct pointer
+	// or a slice of either, whose struct type carries jsonapi annotations.
+	nested bool
+}
+
+// typePlan is the compiled form of a jsonapi annotated struct type.
+type typePlan struct {
+	// fields holds a plan for every jsonapi annotated field, including the
+	// ones promoted from embedded structs, in field order.
+	fields []*fieldPlan
+	// err is set when a malformed jsonapi tag was found. fields then holds
+	// the fields declared before the malformed one.
+	err error
+	// primary is the plan of the field annotated with "primary", if any.
+	primary *fieldPlan
+	// polyrelationFields maps the name of every polyrelation field to the
+	// type of that field.
+	polyrelationFields map[string]reflect.Type
+	// attributes and relationships hold the names of every attribute and
+	// relationship defined by the type.
+	attributes    map[string]struct{}
+	relationships map[string]struct{}
+}
+
+// choicePlan is the compiled form of a polyrelation choice type struct.
+type choicePlan struct {
+	// mapping maps the primary type of each choice to its field.
+	mapping map[string]structFieldIndex
+	// fields holds the field numbers of valid choices, in field order.
+	fields []int
+}
+
+// typePlanFor returns the compiled plan of the struct type t. The plan is
+// computed on first use and cached for the lifetime of the process; it is
+// safe for concurrent use. typePlanFor panics if t is not a struct type.
+func typePlanFor(t reflect.Type) *typePlan {
+	if p, ok := typePlans.Load(t); ok {
+		return p.(*typePlan)
+	}
+
+	p, _ := typePlans.LoadOrStore(t, compileTypePlan(t))
+	return p.(*typePlan)
+}
+
+func compileTypePlan(t reflect.Type) *typePlan {
+	plan := &typePlan{
+		polyrelationFields: map[string]reflect.Type{},
+		attributes:         map[string]struct{}{},
+		relationships:      map[string]struct{}{},
+	}
+
+	plan.fields, plan.err = compileFieldPlans(t)
+
+	for _, field := range plan.fields {
+		switch field.annotation {
+		case annotationPrimary:
+			if plan.primary == nil {
+				plan.primary = field
+			}
+		case annotationAttribute:
+			plan.attributes[field.name] = struct{}{}
+		case annotationRelation:
+			plan.relationships[field.name] = struct{}{}
+		case annotationPolyRelation:
+			plan.polyrelationFields[field.name] = field.structField.Type
+			plan.relationships[field.name] = struct{}{}
+		}
+	}
+
+	return plan
+}
+
+// compileFieldPlans returns the plans of the jsonapi annotated fields of the
+// struct type t, in field order. Fields of embedded structs that carry no
+// jsonapi tag themselves are promoted, following the rules of encoding/json:
+// of the fields defining the same member, the least nested one wins, and if
+// several promoted fields share that depth, none of them is kept. When a
+// malformed tag is found, the fields compiled so far are returned along with
+// the error.
+func compileFieldPlans(t reflect.Type) ([]*fieldPlan, error) {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	var fields []*fieldPlan
+	var err error
+
+	visited := map[reflect.Type]bool{}
+	next := []embedded{{typ: t}}
+
+scan:
+	for len(next) > 0 {
+		current := next
+		next = nil
+
+		level := map[reflect.Type]bool{}
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			level[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				structField := e.typ.Field(i)
+				index := append(append([]int(nil), e.index...), i)
+
+				var args []string
+				args, err = getStructTags(structField)
+				if err != nil {
+					break scan
+				}
+
+				if len(args) > 0 {
+					fields = append(fields, compileFieldPlan(structField, index, args))
+					continue
+				}
+
+				if !structField.Anonymous {
+					continue
+				}
+
+				fieldType := structField.Type
+				if fieldType.Kind() == reflect.Ptr {
+					// Pointers to unexported struct types cannot be allocated
+					if !structField.IsExported() {
+						continue
+					}
+					fieldType = fieldType.Elem()
+				}
+				if fieldType.Kind() == reflect.Struct {
+					next = append(next, embedded{typ: fieldType, index: index})
+				}
+			}
+		}
+
+		for typ := range level {
+			visited[typ] = true
+		}
+	}
+
+	return dominantFields(fields), err
+}
+
+// dominantFields drops the fields that are shadowed by, or conflict with,
+// another field defining the same member, and sorts the others in field
+// order.
+func dominantFields(fields []*fieldPlan) []*fieldPlan {
+	depths := map[string]int{}
+	counts := map[string]int{}
+	for _, field := range fields {
+		key := field.memberKey()
+		depth, ok := depths[key]
+		if !ok || len(field.index) < depth {
+			depths[key] = len(field.index)
+			counts[key] = 1
+		} else if len(field.index) == depth {
+			counts[key]++
+		}
+	}
+
+	dominant := make([]*fieldPlan, 0, len(fields))
+	for _, field := range fields {
+		key := field.memberKey()
+		// Fields declared on the struct itself are always kept, as a
+		// polyrelation may share its name with a deprecated relation
+		depth := depths[key]
+		if len(field.index) == depth && (depth == 1 || counts[key] == 1) {
+			dominant = append(dominant, field)
+		}
+	}
+
+	sort.Slice(dominant, func(i, j int) bool {
+		a, b := dominant[i].index, dominant[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+
+	return dominant
+}
+
+// memberKey identifies the member of the resource object that field defines.
+// Attributes and relationships share the same namespace, the fields of the
+// resource object.
+func (f *fieldPlan) memberKey() string {
+	switch f.annotation {
+	case annotationAttribute, annotationRelation, annotationPolyRelation:
+		return "field:" + f.name
+	case annotationMeta:
+		if f.name != "" {
+			return "meta:" + f.name
+		}
+	}
+	return f.annotation
+}
+
+func compileFieldPlan(structField reflect.StructField, index []int, args []string) *fieldPlan {
+	fieldType := structField.Type
+
+	field := &fieldPlan{
+		structField: structField,
+		index:       index,
+		annotation:  args[0],
+		kind:        fieldType.Kind(),
+		isSlice:     fieldType.Kind() == reflect.Slice,
+	}
+
+	if len(args) > 1 {
+		field.name = args[1]
+	}
+
+	if fieldType.Kind() == reflect.Ptr {
+		field.kind = fieldType.Elem().Kind()
+	}
+
+	if len(args) > 2 {
+		for _, arg := range args[2:] {
+			switch arg {
+			case annotationOmitEmpty:
+				field.omitEmpty = true
+			case annotationISO8601:
+				field.iso8601 = true
+			case annotationRFC3339:
+				field.rfc3339 = true
+			case annotationMerge:
+				field.merge = true
+			}
+		}
+	}
+
+	typeName := fieldType.Name()
+	field.isNullableAttr = strings.HasPrefix(typeName, "NullableAttr[")
+	field.isNullableRelationship = strings.HasPrefix(typeName, "NullableRelationship[")
+	field.isToOne = strings.HasPrefix(typeName, "ToOne[")
+	field.isToMany = strings.HasPrefix(typeName, "ToMany[")
+
+	if field.annotation == annotationAttribute ||
+		(field.annotation == annotationMeta && field.name != "") {
+		valueType := fieldType
+		if field.isNullableAttr {
+			valueType = valueType.Elem()
+		}
+		field.setValueType(valueType)
+	}
+
+	return field
+}
+
+// setValueType sets the flags of an attribute field that depend on the type
+// of its value.
+func (f *fieldPlan) setValueType(valueType reflect.Type) {
+	f.isTime = valueType == timeType
+	f.isTimePtr = valueType == timePtrType
+
+	if valueType.Kind() == reflect.Slice {
+		valueType = valueType.Elem()
+	}
+	if valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+	f.nested = valueType.Kind() == reflect.Struct &&
+		valueType != timeType &&
+		hasJSONAPIAnnotations(valueType)
+}
+
+// elementPlan returns the plan of the elements of type t of the slice, array
+// or map attribute compiled into f. Pointer elements are planned for the type
+// they point to. The elements share the options of the attribute, e.g. its
+// time format.
+func (f *fieldPlan) elementPlan(t reflect.Type) *fieldPlan {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	element := *f
+	element.structField.Type = t
+	element.kind = t.Kind()
+	element.isSlice = t.Kind() == reflect.Slice
+	element.isNullableAttr = false
+	element.isNullableRelationship = false
+	element.setValueType(t)
+
+	return &element
+}
+
+// choicePlanFor returns the compiled plan of the polyrelation choice type
+// struct found in choice, which may be the struct type itself or a pointer or
+// slice leading to it.
+func choicePlanFor(choice reflect.Type) *choicePlan {
+	for choice.Kind() != reflect.Struct {
+		choice = choice.Elem()
+	}
+
+	if p, ok := choicePlans.Load(choice); ok {
+		return p.(*choicePlan)
+	}
+
+	p, _ := choicePlans.LoadOrStore(choice, compileChoicePlan(choice))
+	return p.(*choicePlan)
+}
+
+func compileChoicePlan(choice reflect.Type) *choicePlan {
+	plan := &choicePlan{mapping: make(map[string]structFieldIndex)}
+
+	for i := 0; i < choice.NumField(); i++ {
+		fieldType := choice.Field(i)
+
+		// Must be a pointer
+		if fieldType.Type.Kind() != reflect.Ptr {
+			continue
+		}
+
+		subtype := fieldType.Type.Elem()
+
+		// Must be a pointer to struct
+		if subtype.Kind() != reflect.Struct {
+			continue
+		}
+
+		if t, err := jsonapiTypeOfModel(subtype); err == nil {
+			plan.mapping[t] = structFieldIndex{
+				Type:     subtype,
+				FieldNum: i,
+			}
+			plan.fields = append(plan.fields, i)
+		}
+	}
+
+	return plan
+}
+
+// relatedModelTypes returns the struct types of the models a relation or
+// polyrelation field may hold.
+func relatedModelTypes(field *fieldPlan) []reflect.Type {
+	t := field.structField.Type
+	if field.isNullableRelationship {
+		t = t.Elem()
+	}
+	if field.isToOne || field.isToMany {
+		data, _ := t.FieldByName("Data")
+		t = data.Type
+	}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if field.annotation != annotationPolyRelation {
+		return []reflect.Type{t}
+	}
+
+	choices := choicePlanFor(t)
+	types := make([]reflect.Type, 0, len(choices.fields))
+	for _, i := range choices.fields {
+		types = append(types, t.Field(i).Type.Elem())
+	}
+	return types
+}
+
+// reachableTypes returns the primary types of the model type t and of every
+// model type that can be reached from it through relationships.
+func reachableTypes(t reflect.Type) map[string]struct{} {
+	types := map[string]struct{}{}
+	visited := map[reflect.Type]bool{}
+
+	var visit func(t reflect.Type)
+	visit = func(t reflect.Type) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+
+		plan := typePlanFor(t)
+		if plan.primary != nil {
+			types[plan.primary.name] = struct{}{}
+		}
+
+		for _, field := range plan.fields {
+			if field.annotation != annotationRelation && field.annotation != annotationPolyRelation {
+				continue
+			}
+			for _, related := range relatedModelTypes(field) {
+				visit(related)
+			}
+		}
+	}
+	visit(t)
+
+	return types
+}
+
+// fieldByIndex returns the field of the struct v with the given index
+// sequence. It reports false when the field cannot be reached because an
+// embedded struct pointer on the way is nil.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc returns the field of the struct v with the given index
+// sequence, allocating the nil embedded struct pointers on the way.
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
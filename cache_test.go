@@ -0,0 +1,142 @@
+package jsonapi
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestTypePlanFor_compilesFields(t *testing.T) {
+	plan := typePlanFor(reflect.TypeOf(WithNullableAttrs{}))
+
+	if plan.err != nil {
+		t.Fatalf("unexpected plan error: %v", plan.err)
+	}
+	if plan.primary == nil || plan.primary.name != "with-nullables" {
+		t.Fatalf("expected primary type %q, got %+v", "with-nullables", plan.primary)
+	}
+
+	byName := map[string]*fieldPlan{}
+	for _, field := range plan.fields {
+		byName[field.name] = field
+	}
+
+	rfc3339Time := byName["rfc3339_time"]
+	if rfc3339Time == nil {
+		t.Fatal("expected a plan for rfc3339_time")
+	}
+	if !rfc3339Time.rfc3339 || !rfc3339Time.omitEmpty || rfc3339Time.iso8601 {
+		t.Errorf("unexpected options for rfc3339_time: %+v", rfc3339Time)
+	}
+	if !rfc3339Time.isNullableAttr || !rfc3339Time.isTime {
+		t.Errorf("expected rfc3339_time to be a nullable time attribute")
+	}
+
+	comment := byName["nullable_comment"]
+	if comment == nil || !comment.isNullableRelationship || comment.annotation != annotationRelation {
+		t.Errorf("unexpected plan for nullable_comment: %+v", comment)
+	}
+
+	if plan != typePlanFor(reflect.TypeOf(WithNullableAttrs{})) {
+		t.Error("expected the plan to be cached")
+	}
+}
+
+func TestTypePlanFor_nestedAttributes(t *testing.T) {
+	plan := typePlanFor(reflect.TypeOf(Company{}))
+
+	for _, field := range plan.fields {
+		expected := field.name == "boss" || field.name == "manager" ||
+			field.name == "teams" || field.name == "people"
+		if field.nested != expected {
+			t.Errorf("expected nested to be %v for %q", expected, field.name)
+		}
+	}
+}
+
+func TestTypePlanFor_malformedTag(t *testing.T) {
+	plan := typePlanFor(reflect.TypeOf(BadModel{}))
+
+	if plan.err != ErrBadJSONAPIStructTag {
+		t.Fatalf("expected %v, got %v", ErrBadJSONAPIStructTag, plan.err)
+	}
+	if _, err := jsonapiTypeOfModel(reflect.TypeOf(BadModel{})); err != ErrBadJSONAPIStructTag {
+		t.Fatalf("expected %v, got %v", ErrBadJSONAPIStructTag, err)
+	}
+}
+
+func TestTypePlanFor_concurrentUse(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			out := bytes.NewBuffer(nil)
+			if err := MarshalPayload(out, testBlog()); err != nil {
+				errs <- err
+				return
+			}
+			if err := UnmarshalPayload(out, new(Blog)); err != nil {
+				errs <- err
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestTypePlanFor_embeddedFields(t *testing.T) {
+	for _, tc := range []struct {
+		model   interface{}
+		primary string
+		names   []string
+	}{
+		{Widget{}, "widgets", []string{"widgets", "created_at", "updated_at", "omitempty", "name", "owner"}},
+		{Gizmo{}, "gizmos", []string{"updated_at", "omitempty", "gizmos", "created_at"}},
+		{Banner{}, "banners", []string{"banners", "lang"}},
+	} {
+		plan := typePlanFor(reflect.TypeOf(tc.model))
+
+		if plan.err != nil {
+			t.Fatalf("unexpected plan error: %v", plan.err)
+		}
+		if plan.primary == nil || plan.primary.name != tc.primary {
+			t.Fatalf("expected primary type %q, got %+v", tc.primary, plan.primary)
+		}
+
+		var names []string
+		for _, field := range plan.fields {
+			names = append(names, field.name)
+		}
+		if !reflect.DeepEqual(names, tc.names) {
+			t.Errorf("expected fields %q for %T, got %q", tc.names, tc.model, names)
+		}
+	}
+}
+
+func BenchmarkTypePlanFor(b *testing.B) {
+	t := reflect.TypeOf(Blog{})
+
+	b.Run("cached", func(b *testing.B) {
+		typePlanFor(t)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			typePlanFor(t)
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			compileTypePlan(t)
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package jsonapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// AttributeEncoder encodes an attribute value of the type it was registered
+// for into a value that encoding/json can marshal, e.g. a string or a
+// json.RawMessage.
+type AttributeEncoder func(value interface{}) (interface{}, error)
+
+// AttributeDecoder decodes the JSON value of an attribute into a value of the
+// type it was registered for.
+type AttributeDecoder func(data json.RawMessage) (interface{}, error)
+
+// attributeCodecs holds the codecs registered with RegisterAttributeCodec.
+var attributeCodecs codecRegistry
+
+// RegisterAttributeCodec registers the functions used to encode and decode
+// attributes of type t, for types that cannot implement json.Marshaler and
+// json.Unmarshaler themselves, e.g. *big.Int or time.Duration. The codec is
+// consulted before any built-in handling, for fields of type t and of pointers
+// to t, including inside NullableAttr. Either function may be nil, in which
+// case the built-in handling is used in that direction. Registering a codec
+// for a type that already has one replaces it.
+//
+// Codecs registered with a Runtime take precedence over those registered
+// with RegisterAttributeCodec.
+func RegisterAttributeCodec(t reflect.Type, encode AttributeEncoder, decode AttributeDecoder) {
+	attributeCodecs.register(t, encode, decode)
+}
+
+type attributeCodec struct {
+	encode AttributeEncoder
+	decode AttributeDecoder
+}
+
+// codecRegistry maps types to their attribute codec. It is safe for
+// concurrent use.
+type codecRegistry struct {
+	codecs sync.Map
+}
+
+func (r *codecRegistry) register(t reflect.Type, encode AttributeEncoder, decode AttributeDecoder) {
+	r.codecs.Store(t, &attributeCodec{encode: encode, decode: decode})
+}
+
+func (r *codecRegistry) lookup(t reflect.Type) *attributeCodec {
+	if r == nil {
+		return nil
+	}
+	if c, ok := r.codecs.Load(t); ok {
+		return c.(*attributeCodec)
+	}
+	return nil
+}
+
+// findCodec returns the codec for values of type t, looking it up in local
+// first and then in the global registry. A codec registered for the type t
+// points to is returned as well. The type the codec was registered for is
+// returned along with it.
+func findCodec(local *codecRegistry, t reflect.Type) (*attributeCodec, reflect.Type) {
+	for _, r := range []*codecRegistry{local, &attributeCodecs} {
+		if c := r.lookup(t); c != nil {
+			return c, t
+		}
+		if t.Kind() == reflect.Ptr {
+			if c := r.lookup(t.Elem()); c != nil {
+				return c, t.Elem()
+			}
+		}
+	}
+	return nil, nil
+}
+
+// encodeValue encodes v with the encoder of codec, registered for type t. v
+// is either of type t or a pointer to t, in which case a nil pointer is
+// encoded as null.
+func encodeValue(codec *attributeCodec, t reflect.Type, v reflect.Value) (interface{}, error) {
+	if v.Type() != t {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	return codec.encode(v.Interface())
+}
+
+// decodeValue decodes attribute with the decoder of codec, registered for
+// type t. Values of a non-pointer type are returned behind a pointer, like
+// numbers are.
+func decodeValue(codec *attributeCodec, t reflect.Type, attribute interface{}) (reflect.Value, error) {
+	data, err := json.Marshal(attribute)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	decoded, err := codec.decode(data)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	v := reflect.ValueOf(decoded)
+	if !v.IsValid() || v.Type() != t {
+		return reflect.Value{}, fmt.Errorf("%w: decoder for %v returned %T", ErrInvalidType, t, decoded)
+	}
+
+	if t.Kind() == reflect.Ptr {
+		return v, nil
+	}
+	p := reflect.New(t)
+	p.Elem().Set(v)
+	return p, nil
+}
+
+var (
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isMarshaler reports whether t, or a pointer to t, implements json.Marshaler
+// or encoding.TextMarshaler.
+func isMarshaler(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType)
+}
+
+// isUnmarshaler reports whether a pointer to t, or to the type t points to,
+// implements json.Unmarshaler or encoding.TextUnmarshaler.
+func isUnmarshaler(t reflect.Type) bool {
+	if t.Kind() != reflect.Ptr {
+		t = reflect.PtrTo(t)
+	}
+	return t.Implements(jsonUnmarshalerType) || t.Implements(textUnmarshalerType)
+}
+
+// marshalValue encodes v, whose type must satisfy isMarshaler, using its
+// MarshalJSON or MarshalText method. json.Marshaler takes precedence, as it
+// does for encoding/json. The method is called through a pointer, so that
+// methods declared on a pointer receiver are honored as well. A nil pointer
+// is encoded as null.
+func marshalValue(v reflect.Value) (interface{}, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+	} else if v.CanAddr() {
+		v = v.Addr()
+	} else {
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+	}
+
+	if m, ok := v.Interface().(json.Marshaler); ok {
+		b, err := m.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(b), nil
+	}
+
+	b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// unmarshalValue decodes attribute into a new value of type t, whose type
+// must satisfy isUnmarshaler, using its UnmarshalJSON or UnmarshalText
+// method. json.Unmarshaler takes precedence, as it does for encoding/json;
+// encoding.TextUnmarshaler is only used for JSON strings. A JSON number for a
+// numeric type that only unmarshals text, e.g. an enum, is unmarshaled as a
+// number, as it always was. A pointer to the new value is returned.
+func unmarshalValue(attribute interface{}, t reflect.Type) (reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	v := reflect.New(t)
+
+	u, ok := v.Interface().(json.Unmarshaler)
+	if !ok && isNumericKind(t.Kind()) {
+		switch attribute.(type) {
+		case json.Number, float64:
+			return handleNumeric(attribute, t, v.Elem())
+		}
+	}
+
+	if ok {
+		data, err := json.Marshal(attribute)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return v, u.UnmarshalJSON(data)
+	}
+
+	s, ok := attribute.(string)
+	if !ok {
+		return reflect.Value{}, ErrInvalidType
+	}
+	return v, v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+}
+
+// isNumericKind reports whether k is the kind of an integer or a float.
+func isNumericKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
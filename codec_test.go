@@ -0,0 +1,133 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func init() {
+	RegisterAttributeCodec(reflect.TypeOf(new(big.Int)),
+		func(value interface{}) (interface{}, error) {
+			return value.(*big.Int).String(), nil
+		},
+		func(data json.RawMessage) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			n, ok := new(big.Int).SetString(s, 10)
+			if !ok {
+				return nil, errors.New("invalid integer")
+			}
+			return n, nil
+		},
+	)
+}
+
+func durationRuntime() *Runtime {
+	return NewRuntime().RegisterAttributeCodec(reflect.TypeOf(time.Duration(0)),
+		func(value interface{}) (interface{}, error) {
+			return value.(time.Duration).String(), nil
+		},
+		func(data json.RawMessage) (interface{}, error) {
+			var s string
+			if err := json.Unmarshal(data, &s); err != nil {
+				return nil, err
+			}
+			return time.ParseDuration(s)
+		},
+	)
+}
+
+func TestRegisterAttributeCodec(t *testing.T) {
+	balance, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	account := &Account{
+		ID:      "1",
+		Balance: balance,
+		Limit:   NewNullableAttrWithValue(big.NewInt(42)),
+		Timeout: 90,
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, account); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"balance":"123456789012345678901234567890"`) ||
+		!strings.Contains(out.String(), `"limit":"42"`) ||
+		!strings.Contains(out.String(), `"timeout":90`) {
+		t.Fatalf("Unexpected payload %s", out.String())
+	}
+
+	decoded := new(Account)
+	if err := UnmarshalPayload(out, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Balance.Cmp(balance) != 0 {
+		t.Errorf("Expected balance %v, got %v", balance, decoded.Balance)
+	}
+	if limit, err := decoded.Limit.Get(); err != nil || limit.Int64() != 42 {
+		t.Errorf("Expected limit 42, got %v (%v)", limit, err)
+	}
+	if decoded.Timeout != 90 {
+		t.Errorf("Expected timeout 90, got %v", decoded.Timeout)
+	}
+}
+
+func TestRegisterAttributeCodec_decodeError(t *testing.T) {
+	in := strings.NewReader(`{"data": {"type": "accounts", "id": "1", "attributes": {"balance": "lots"}}}`)
+
+	err := UnmarshalPayload(in, new(Account))
+
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/attributes/balance" {
+		t.Fatalf("Expected an *UnmarshalError at /data/attributes/balance, got %v", err)
+	}
+}
+
+func TestRuntime_RegisterAttributeCodec(t *testing.T) {
+	runtime := durationRuntime()
+	account := &Account{
+		ID:       "1",
+		Timeout:  90 * time.Second,
+		Timeouts: NewNullableAttrWithValue(time.Minute),
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := runtime.MarshalPayload(out, account); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"timeout":"1m30s"`) || !strings.Contains(out.String(), `"timeouts":"1m0s"`) {
+		t.Fatalf("Unexpected payload %s", out.String())
+	}
+
+	decoded := new(Account)
+	if err := runtime.UnmarshalPayload(bytes.NewReader(out.Bytes()), decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Timeout != 90*time.Second {
+		t.Errorf("Expected timeout 1m30s, got %v", decoded.Timeout)
+	}
+	if timeouts, err := decoded.Timeouts.Get(); err != nil || timeouts != time.Minute {
+		t.Errorf("Expected timeouts 1m0s, got %v (%v)", timeouts, err)
+	}
+
+	// The codec is not used outside of the runtime
+	if err := UnmarshalPayload(bytes.NewReader(out.Bytes()), new(Account)); err == nil {
+		t.Fatal("Expected the package level functions not to use the runtime codec")
+	}
+
+	accounts, err := RuntimeUnmarshalMany[Account](runtime, strings.NewReader(
+		`{"data": [{"type": "accounts", "id": "1", "attributes": {"timeout": "2s"}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accounts[0].Timeout != 2*time.Second {
+		t.Errorf("Expected timeout 2s, got %v", accounts[0].Timeout)
+	}
+}
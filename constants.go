@@ -9,9 +9,11 @@ const (
 	annotationRelation     = "relation"
 	annotationPolyRelation = "polyrelation"
 	annotationLinks        = "links"
+	annotationMeta         = "meta"
 	annotationOmitEmpty    = "omitempty"
 	annotationISO8601      = "iso8601"
 	annotationRFC3339      = "rfc3339"
+	annotationMerge        = "merge"
 	annotationSeparator    = ","
 
 	iso8601TimeFormat = "2006-01-02T15:04:05Z"
@@ -0,0 +1,123 @@
+package jsonapi
+
+import (
+	"io"
+	"reflect"
+)
+
+// Document is a JSON API document whose primary data has been unmarshaled
+// into Data, e.g. a *Blog for a single resource document or a []*Blog for a
+// collection document, along with the other top-level members of the
+// document.
+type Document[T any] struct {
+	Data    T
+	Links   *Links
+	Meta    *Meta
+	JSONAPI *JSONAPIObject
+	// Included holds every resource of the "included" array, whether or not a
+	// relationship of Data references it. Numbers are decoded as float64, as
+	// they are in a OnePayload.
+	Included []*Node
+}
+
+// Find returns the included resource with the given type and id, or nil if
+// the document does not include it.
+func (d *Document[T]) Find(typ, id string) *Node {
+	for _, n := range d.Included {
+		if n.Type == typ && n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// FindAll returns the included resources of the given type, in the order of
+// the "included" array.
+func (d *Document[T]) FindAll(typ string) []*Node {
+	var nodes []*Node
+	for _, n := range d.Included {
+		if n.Type == typ {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+// UnmarshalOne converts an io into a new T instance using the jsonapi tags on
+// its struct fields. It is the type-safe equivalent of UnmarshalPayload:
+//
+//	blog, err := jsonapi.UnmarshalOne[Blog](r.Body)
+//
+// T must be a struct type; ErrUnexpectedType is returned otherwise.
+func UnmarshalOne[T any](in io.Reader, opts ...UnmarshalOption) (*T, error) {
+	doc, err := UnmarshalOneDocument[T](in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Data, nil
+}
+
+// UnmarshalMany converts an io into a slice of new T instances using the
+// jsonapi tags on their struct fields. It is the type-safe equivalent of
+// UnmarshalManyPayload:
+//
+//	blogs, err := jsonapi.UnmarshalMany[Blog](r.Body)
+//
+// T must be a struct type; ErrUnexpectedType is returned otherwise.
+func UnmarshalMany[T any](in io.Reader, opts ...UnmarshalOption) ([]*T, error) {
+	doc, err := UnmarshalManyDocument[T](in, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Data, nil
+}
+
+// UnmarshalOneDocument behaves like UnmarshalOne, but also returns the
+// top-level links, meta, jsonapi object and included resources of the
+// document.
+func UnmarshalOneDocument[T any](in io.Reader, opts ...UnmarshalOption) (*Document[*T], error) {
+	model := new(T)
+	if reflect.TypeOf(model).Elem().Kind() != reflect.Struct {
+		return nil, ErrUnexpectedType
+	}
+
+	payload, err := unmarshalOnePayload(in, model, newUnmarshalOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	normalizeNodes(payload.Included)
+
+	return &Document[*T]{
+		Data:     model,
+		Links:    payload.Links,
+		Meta:     payload.Meta,
+		JSONAPI:  payload.JSONAPI,
+		Included: payload.Included,
+	}, nil
+}
+
+// UnmarshalManyDocument behaves like UnmarshalMany, but also returns the
+// top-level links, meta, jsonapi object and included resources of the
+// document.
+func UnmarshalManyDocument[T any](in io.Reader, opts ...UnmarshalOption) (*Document[[]*T], error) {
+	models, payload, err := unmarshalManyPayload(in, reflect.TypeOf(new(T)), newUnmarshalOptions(opts))
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]*T, len(models))
+	for i, model := range models {
+		data[i] = model.(*T)
+	}
+
+	normalizeNodes(payload.Included)
+
+	return &Document[[]*T]{
+		Data:     data,
+		Links:    payload.Links,
+		Meta:     payload.Meta,
+		JSONAPI:  payload.JSONAPI,
+		Included: payload.Included,
+	}, nil
+}
@@ -0,0 +1,205 @@
+package jsonapi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalOne(t *testing.T) {
+	blog, err := UnmarshalOne[Blog](samplePayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blog.Title != "New blog" {
+		t.Fatalf("Expected title %q, got %q", "New blog", blog.Title)
+	}
+	if len(blog.Posts) != 2 {
+		t.Fatalf("Expected 2 posts, got %d", len(blog.Posts))
+	}
+}
+
+func TestUnmarshalMany(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": [
+			{"type": "posts", "id": "1", "attributes": {"title": "First"}},
+			{"type": "posts", "id": "2", "attributes": {"title": "Second"}}
+		]
+	}`)
+
+	posts, err := UnmarshalMany[Post](in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 2 {
+		t.Fatalf("Expected 2 posts, got %d", len(posts))
+	}
+	if posts[0].ID != 1 || posts[1].Title != "Second" {
+		t.Fatalf("Unexpected posts %+v %+v", posts[0], posts[1])
+	}
+}
+
+func TestUnmarshalOneDocument(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {"type": "blogs", "id": "1", "attributes": {"title": "Title"}},
+		"links": {"self": "http://example.com/blogs/1"},
+		"meta": {"version": "1.0"}
+	}`)
+
+	doc, err := UnmarshalOneDocument[Blog](in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Data.ID != 1 || doc.Data.Title != "Title" {
+		t.Fatalf("Unexpected data %+v", doc.Data)
+	}
+	if doc.Links == nil || (*doc.Links)["self"] != "http://example.com/blogs/1" {
+		t.Fatalf("Unexpected links %v", doc.Links)
+	}
+	if doc.Meta == nil || (*doc.Meta)["version"] != "1.0" {
+		t.Fatalf("Unexpected meta %v", doc.Meta)
+	}
+}
+
+func TestUnmarshalManyDocument(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": [{"type": "blogs", "id": "1"}],
+		"links": {"next": "http://example.com/blogs?page=2"},
+		"meta": {"total": 2}
+	}`)
+
+	doc, err := UnmarshalManyDocument[Blog](in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Data) != 1 || doc.Data[0].ID != 1 {
+		t.Fatalf("Unexpected data %+v", doc.Data)
+	}
+	if doc.Links == nil || (*doc.Links)["next"] != "http://example.com/blogs?page=2" {
+		t.Fatalf("Unexpected links %v", doc.Links)
+	}
+	if doc.Meta == nil || (*doc.Meta)["total"] != float64(2) {
+		t.Fatalf("Unexpected meta %v", doc.Meta)
+	}
+}
+
+func TestUnmarshalOne_options(t *testing.T) {
+	in := strings.NewReader(`{"data": {"type": "blogs", "id": "1", "attributes": {"subtitle": "x"}}}`)
+
+	_, err := UnmarshalOne[Blog](in, DisallowUnknownMembers())
+	if !errors.Is(err, ErrUnknownMember) {
+		t.Fatalf("Expected %v, got %v", ErrUnknownMember, err)
+	}
+}
+
+func TestUnmarshal_unexpectedType(t *testing.T) {
+	if _, err := UnmarshalOne[*Blog](samplePayload()); err != ErrUnexpectedType {
+		t.Errorf("Expected %v, got %v", ErrUnexpectedType, err)
+	}
+	if _, err := UnmarshalMany[string](samplePayload()); err != ErrUnexpectedType {
+		t.Errorf("Expected %v, got %v", ErrUnexpectedType, err)
+	}
+
+	for _, typ := range []reflect.Type{nil, reflect.TypeOf(Blog{}), reflect.TypeOf(new(string))} {
+		if _, err := UnmarshalManyPayload(samplePayload(), typ); err != ErrUnexpectedType {
+			t.Errorf("Expected %v for %v, got %v", ErrUnexpectedType, typ, err)
+		}
+	}
+}
+
+func TestRuntimeUnmarshalOne(t *testing.T) {
+	var events []Event
+	Instrumentation = func(r *Runtime, e Event, id string, d time.Duration) {
+		events = append(events, e)
+	}
+	defer func() { Instrumentation = nil }()
+
+	blog, err := RuntimeUnmarshalOne[Blog](NewRuntime(), samplePayload())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blog.Title != "New blog" {
+		t.Fatalf("Expected title %q, got %q", "New blog", blog.Title)
+	}
+	if !reflect.DeepEqual(events, []Event{UnmarshalStart, UnmarshalStop}) {
+		t.Fatalf("Unexpected events %v", events)
+	}
+}
+
+func TestUnmarshalOneDocument_included(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "blogs",
+			"id": "1",
+			"relationships": {
+				"current_post": {"data": {"type": "posts", "id": "1"}}
+			}
+		},
+		"included": [
+			{"type": "posts", "id": "1", "attributes": {"title": "Referenced"}},
+			{"type": "posts", "id": "2", "attributes": {"title": "Unreferenced"}},
+			{"type": "comments", "id": "1", "attributes": {"post_id": 2}}
+		],
+		"jsonapi": {"version": "1.1", "meta": {"revision": 3}}
+	}`)
+
+	doc, err := UnmarshalOneDocument[Blog](in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Data.CurrentPost == nil || doc.Data.CurrentPost.Title != "Referenced" {
+		t.Fatalf("Unexpected current post %+v", doc.Data.CurrentPost)
+	}
+	if doc.JSONAPI == nil || doc.JSONAPI.Version != "1.1" || (*doc.JSONAPI.Meta)["revision"] != float64(3) {
+		t.Fatalf("Unexpected jsonapi object %+v", doc.JSONAPI)
+	}
+	if len(doc.Included) != 3 {
+		t.Fatalf("Expected 3 included resources, got %d", len(doc.Included))
+	}
+
+	if post := doc.Find("posts", "2"); post == nil || post.Attributes["title"] != "Unreferenced" {
+		t.Fatalf("Unexpected post %+v", post)
+	}
+	if comment := doc.Find("comments", "1"); comment == nil || comment.Attributes["post_id"] != float64(2) {
+		t.Fatalf("Unexpected comment %+v", comment)
+	}
+	if node := doc.Find("posts", "3"); node != nil {
+		t.Fatalf("Expected no post, got %+v", node)
+	}
+
+	posts := doc.FindAll("posts")
+	if len(posts) != 2 || posts[0].ID != "1" || posts[1].ID != "2" {
+		t.Fatalf("Unexpected posts %+v", posts)
+	}
+	if nodes := doc.FindAll("authors"); len(nodes) != 0 {
+		t.Fatalf("Expected no authors, got %+v", nodes)
+	}
+}
+
+func TestUnmarshalManyDocument_included(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": [{"type": "blogs", "id": "1"}],
+		"included": [{"type": "posts", "id": "1"}],
+		"jsonapi": {"version": "1.0"}
+	}`)
+
+	doc, err := UnmarshalManyDocument[Blog](in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.JSONAPI == nil || doc.JSONAPI.Version != "1.0" {
+		t.Fatalf("Unexpected jsonapi object %+v", doc.JSONAPI)
+	}
+	if doc.Find("posts", "1") == nil {
+		t.Fatalf("Expected the included post, got %+v", doc.Included)
+	}
+}
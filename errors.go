@@ -1,23 +1,39 @@
 package jsonapi
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 )
 
-// MarshalErrors writes a JSON API response using the given `[]error`.
+// MarshalErrors writes a JSON API response using the given `[]error`. The
+// TopLevelLinks, TopLevelMeta and TopLevelJSONAPI options set the other
+// top-level members of the document.
 //
 // For more information on JSON API error payloads, see the spec here:
 // http://jsonapi.org/format/#document-top-level
 // and here: http://jsonapi.org/format/#error-objects.
-func MarshalErrors(w io.Writer, errorObjects []*ErrorObject) error {
-	return json.NewEncoder(w).Encode(&ErrorsPayload{Errors: errorObjects})
+func MarshalErrors(w io.Writer, errorObjects []*ErrorObject, opts ...MarshalOption) error {
+	o := newMarshalOptions(opts)
+
+	payload := &ErrorsPayload{Errors: errorObjects}
+	if err := o.topLevel(&payload.Links, &payload.Meta, &payload.JSONAPI); err != nil {
+		return err
+	}
+
+	return writePayload(w, payload, o, false)
 }
 
 // ErrorsPayload is a serializer struct for representing a valid JSON API errors payload.
 type ErrorsPayload struct {
-	Errors []*ErrorObject `json:"errors"`
+	Errors  []*ErrorObject `json:"errors"`
+	Links   *Links         `json:"links,omitempty"`
+	Meta    *Meta          `json:"meta,omitempty"`
+	JSONAPI *JSONAPIObject `json:"jsonapi,omitempty"`
 }
 
 // ErrorObject is an `Error` implementation as well as an implementation of the JSON API error object.
@@ -66,3 +82,190 @@ type ErrorSource struct {
 func (e *ErrorObject) Error() string {
 	return fmt.Sprintf("Error: %s %s\n", e.Title, e.Detail)
 }
+
+// UnmarshalError is returned by UnmarshalPayload and UnmarshalManyPayload when
+// a member of the request document could not be unmarshaled into the model.
+//
+// It records where the offending member is found within the document, and
+// can be converted into an ErrorObject with ErrorObject, so that it can be
+// passed directly to `MarshalErrors`.
+type UnmarshalError struct {
+	// Pointer is a JSON Pointer (RFC6901) to the offending member of the
+	// document, e.g. "/data/attributes/created_at" or
+	// "/included/3/relationships/author".
+	Pointer string
+
+	// Field is the name of the struct field the member was unmarshaled into.
+	// Fields of nested attribute structs are separated by dots, e.g.
+	// "Boss.HiredAt". Field is empty if the member has no matching field.
+	Field string
+
+	// Type is the type the member was expected to be unmarshaled into.
+	Type reflect.Type
+
+	// Err is the underlying cause, e.g. ErrInvalidType or ErrInvalidISO8601.
+	Err error
+}
+
+// Error implements the `Error` interface.
+func (e *UnmarshalError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Pointer, e.Err)
+}
+
+// Unwrap returns the underlying cause, so that the error can be inspected
+// with `errors.Is` and `errors.As`.
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorObject returns a JSON API error object describing the error, with its
+// source pointing at the offending member of the request document. Members
+// the model does not define are reported as a 400 Bad Request, a resource
+// that does not match the model of UnmarshalPatch as a 409 Conflict, and any
+// other member as a 422 Unprocessable Entity.
+func (e *UnmarshalError) ErrorObject() *ErrorObject {
+	status := http.StatusUnprocessableEntity
+	if errors.Is(e.Err, ErrUnknownMember) || errors.Is(e.Err, ErrUnknownType) {
+		status = http.StatusBadRequest
+	} else if errors.Is(e.Err, ErrResourceMismatch) {
+		status = http.StatusConflict
+	}
+
+	return &ErrorObject{
+		Title:  "Invalid Member",
+		Detail: e.Err.Error(),
+		Status: strconv.Itoa(status),
+		Source: &ErrorSource{Pointer: e.Pointer},
+	}
+}
+
+// LimitError is returned when a document exceeds one of the Limits set with
+// the UnmarshalLimits or MarshalLimits options. It wraps ErrLimitExceeded.
+type LimitError struct {
+	// Pointer is a JSON Pointer (RFC6901) to the member of the document that
+	// exceeds the limit, e.g. "/included" or "/data/attributes/body".
+	Pointer string
+
+	// Limit is the name of the exceeded field of Limits, e.g. "MaxIncluded".
+	Limit string
+
+	// Max is the value of the exceeded limit.
+	Max int
+}
+
+// Error implements the `Error` interface.
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %v: %s is %d", e.Pointer, ErrLimitExceeded, e.Limit, e.Max)
+}
+
+// Unwrap returns ErrLimitExceeded, so that the error can be inspected with
+// `errors.Is`.
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// ErrorObject returns a JSON API error object describing the error, with its
+// source pointing at the member of the request document that exceeds the
+// limit. Documents nested too deeply are reported as a 400 Bad Request, and
+// documents too large as a 413 Request Entity Too Large.
+func (e *LimitError) ErrorObject() *ErrorObject {
+	status := http.StatusRequestEntityTooLarge
+	if e.Limit == "MaxDepth" {
+		status = http.StatusBadRequest
+	}
+
+	return &ErrorObject{
+		Title:  "Limit Exceeded",
+		Detail: e.Error(),
+		Status: strconv.Itoa(status),
+		Source: &ErrorSource{Pointer: e.Pointer},
+	}
+}
+
+// IncludeError is returned by the marshal functions given the Include option
+// when an include path does not name a relationship of the models. It wraps
+// ErrInvalidInclude.
+type IncludeError struct {
+	// Path is the offending include path, e.g. "comments.author".
+	Path string
+
+	// Relationship is the first name of Path that is not a relationship, e.g.
+	// "author".
+	Relationship string
+}
+
+// Error implements the `Error` interface.
+func (e *IncludeError) Error() string {
+	return fmt.Sprintf("%v %q: %q is not a relationship", ErrInvalidInclude, e.Path, e.Relationship)
+}
+
+// Unwrap returns ErrInvalidInclude, so that the error can be inspected with
+// `errors.Is`.
+func (e *IncludeError) Unwrap() error {
+	return ErrInvalidInclude
+}
+
+// ErrorObject returns a JSON API error object describing the error, with a
+// 400 Bad Request status and its source pointing at the `include` query
+// parameter, as the JSON API spec requires.
+func (e *IncludeError) ErrorObject() *ErrorObject {
+	return &ErrorObject{
+		Title:  "Invalid Include",
+		Detail: e.Error(),
+		Status: strconv.Itoa(http.StatusBadRequest),
+		Source: &ErrorSource{Parameter: "include"},
+	}
+}
+
+// UnmarshalErrors is returned by UnmarshalPayload and UnmarshalManyPayload
+// when unmarshaling with the CollectErrors option, and holds an
+// *UnmarshalError for every member of the document that could not be
+// unmarshaled.
+type UnmarshalErrors []*UnmarshalError
+
+// Error implements the `Error` interface.
+func (e UnmarshalErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the collected errors, so that they can be inspected with
+// `errors.Is` and `errors.As`.
+func (e UnmarshalErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// ErrorObjects returns a JSON API error object for every collected error, to
+// be passed to `MarshalErrors`.
+func (e UnmarshalErrors) ErrorObjects() []*ErrorObject {
+	objects := make([]*ErrorObject, len(e))
+	for i, err := range e {
+		objects[i] = err.ErrorObject()
+	}
+	return objects
+}
+
+// newUnmarshalError wraps err, raised while unmarshaling the member found at
+// pointer into the struct field at fieldPath of type t, in an
+// *UnmarshalError. Errors that already carry a pointer, e.g. those raised
+// from within a nested attribute struct, are returned unchanged.
+func newUnmarshalError(pointer string, fieldPath string, t reflect.Type, err error) error {
+	var ue *UnmarshalError
+	if errors.As(err, &ue) {
+		return err
+	}
+
+	return &UnmarshalError{
+		Pointer: pointer,
+		Field:   fieldPath,
+		Type:    t,
+		Err:     err,
+	}
+}
@@ -3,6 +3,7 @@ package jsonapi
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -24,6 +25,7 @@ func TestMarshalErrorsWritesTheExpectedPayload(t *testing.T) {
 	var marshalErrorsTableTasts = []struct {
 		Title string
 		In    []*ErrorObject
+		Opts  []MarshalOption
 		Out   map[string]interface{}
 	}{
 		{
@@ -40,13 +42,28 @@ func TestMarshalErrorsWritesTheExpectedPayload(t *testing.T) {
 				map[string]interface{}{"title": "Test title.", "detail": "Test detail", "meta": map[string]interface{}{"key": "val"}},
 			}},
 		},
+		{
+			Title: "TestTopLevelMembersAreSerialized",
+			In:    []*ErrorObject{{Title: "Test title."}},
+			Opts: []MarshalOption{
+				TopLevelLinks(&Links{"about": "https://example.com/errors"}),
+				TopLevelMeta(&Meta{"request_id": "abc"}),
+				TopLevelJSONAPI(&JSONAPIObject{Version: "1.1"}),
+			},
+			Out: map[string]interface{}{
+				"errors":  []interface{}{map[string]interface{}{"title": "Test title."}},
+				"links":   map[string]interface{}{"about": "https://example.com/errors"},
+				"meta":    map[string]interface{}{"request_id": "abc"},
+				"jsonapi": map[string]interface{}{"version": "1.1"},
+			},
+		},
 	}
 	for _, testRow := range marshalErrorsTableTasts {
 		t.Run(testRow.Title, func(t *testing.T) {
 			buffer, output := bytes.NewBuffer(nil), map[string]interface{}{}
 			var writer io.Writer = buffer
 
-			_ = MarshalErrors(writer, testRow.In)
+			_ = MarshalErrors(writer, testRow.In, testRow.Opts...)
 			if err := json.Unmarshal(buffer.Bytes(), &output); err != nil {
 				t.Fatalf("failed to unmarshal: %v", err)
 			}
@@ -57,3 +74,101 @@ func TestMarshalErrorsWritesTheExpectedPayload(t *testing.T) {
 		})
 	}
 }
+
+func TestUnmarshalErrorPointers(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		payload string
+		model   interface{}
+		pointer string
+		field   string
+		cause   error
+	}{
+		{
+			desc:    "attribute",
+			payload: `{"data":{"type":"blogs","id":"1","attributes":{"title":5}}}`,
+			model:   new(Blog),
+			pointer: "/data/attributes/title",
+			field:   "Title",
+			cause:   ErrUnknownFieldNumberType,
+		},
+		{
+			desc:    "id",
+			payload: `{"data":{"type":"blogs","id":"abc"}}`,
+			model:   new(Blog),
+			pointer: "/data/id",
+			field:   "ID",
+			cause:   ErrBadJSONAPIID,
+		},
+		{
+			desc: "included resource",
+			payload: `{
+				"data":{"type":"blogs","id":"1","relationships":{"posts":{"data":[{"type":"posts","id":"1"}]}}},
+				"included":[{"type":"comments","id":"1"},{"type":"posts","id":"1","attributes":{"body":false}}]
+			}`,
+			model:   new(Blog),
+			pointer: "/included/1/attributes/body",
+			field:   "Body",
+			cause:   ErrInvalidType,
+		},
+		{
+			desc:    "nested attribute",
+			payload: `{"data":{"type":"companies","id":"1","attributes":{"boss":{"hired-at":5}}}}`,
+			model:   new(Company),
+			pointer: "/data/attributes/boss/hired-at",
+			field:   "Boss.HiredAt",
+			cause:   ErrInvalidISO8601,
+		},
+		{
+			desc:    "pointer attribute",
+			payload: `{"data":{"type":"with-pointers","id":"1","attributes":{"is-active":"yes"}}}`,
+			model:   new(WithPointer),
+			pointer: "/data/attributes/is-active",
+			field:   "IsActive",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := UnmarshalPayload(bytes.NewReader([]byte(tc.payload)), tc.model)
+
+			var unmarshalErr *UnmarshalError
+			if !errors.As(err, &unmarshalErr) {
+				t.Fatalf("expected an *UnmarshalError, got %v", err)
+			}
+			if unmarshalErr.Pointer != tc.pointer {
+				t.Errorf("expected pointer %q, got %q", tc.pointer, unmarshalErr.Pointer)
+			}
+			if unmarshalErr.Field != tc.field {
+				t.Errorf("expected field %q, got %q", tc.field, unmarshalErr.Field)
+			}
+			if tc.cause != nil && !errors.Is(err, tc.cause) {
+				t.Errorf("expected cause %v, got %v", tc.cause, unmarshalErr.Err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrorObject(t *testing.T) {
+	err := &UnmarshalError{
+		Pointer: "/data/attributes/created_at",
+		Field:   "CreatedAt",
+		Err:     ErrInvalidTime,
+	}
+
+	obj := err.ErrorObject()
+
+	if obj.Status != "422" {
+		t.Errorf("expected status 422, got %q", obj.Status)
+	}
+	if obj.Detail != ErrInvalidTime.Error() {
+		t.Errorf("unexpected detail %q", obj.Detail)
+	}
+	if obj.Source == nil || obj.Source.Pointer != err.Pointer {
+		t.Fatalf("expected source pointer %q, got %+v", err.Pointer, obj.Source)
+	}
+}
+
+func TestEscapePointerToken(t *testing.T) {
+	if e, a := "a~1b~0c", escapePointerToken("a/b~c"); e != a {
+		t.Fatalf("expected %q, got %q", e, a)
+	}
+}
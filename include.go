@@ -0,0 +1,211 @@
+package jsonapi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// ErrInvalidInclude is returned, wrapped in an *IncludeError, by the marshal
+// functions given the Include option when an include path does not name a
+// relationship of the models.
+var ErrInvalidInclude = errors.New("invalid include path")
+
+// OffPathRelationships is what the marshal functions given the Include option
+// write for the relationships that are not on an include path.
+type OffPathRelationships int
+
+const (
+	// OffPathLinkage writes the resource linkage of the relationship, along
+	// with its links and meta, without sideloading the related resources.
+	// This is the default.
+	OffPathLinkage OffPathRelationships = iota
+	// OffPathLinksOnly writes the links and meta of the relationship only.
+	// Relationships that have neither are left out, as a relationship object
+	// must hold at least one of data, links or meta.
+	OffPathLinksOnly
+)
+
+// includeTree is the tree of the relationship names of a set of include
+// paths. Every node, leaves included, is a non-nil map.
+type includeTree map[string]includeTree
+
+// Include restricts the resources sideloaded into the "included" array to
+// those found along the given relationship paths, as requested with the
+// `include` query parameter of the JSON API spec, e.g. "comments.author" and
+// "tags":
+//
+//	err := jsonapi.MarshalPayload(w, post, jsonapi.Include("comments.author", "tags"))
+//
+// The resources along a path are sideloaded too, e.g. the comments of
+// "comments.author". Relationships off the paths are written as set by the
+// IncludeOffPath option, and the resources they link to are not sideloaded.
+// Include with no paths sideloads nothing.
+//
+// Every path must name relationships of the models, or marshaling fails with
+// an *IncludeError, whose ErrorObject has a 400 Bad Request status.
+//
+// ParseInclude reads paths from the query of a request.
+func Include(paths ...string) MarshalOption {
+	return func(o *marshalOptions) {
+		o.includePaths = paths
+		o.include = includeTree{}
+		for _, path := range paths {
+			tree := o.include
+			for _, name := range strings.Split(path, ".") {
+				if tree[name] == nil {
+					tree[name] = includeTree{}
+				}
+				tree = tree[name]
+			}
+		}
+	}
+}
+
+// IncludeOffPath sets what is written for the relationships off the include
+// paths of the Include option.
+func IncludeOffPath(r OffPathRelationships) MarshalOption {
+	return func(o *marshalOptions) {
+		o.offPath = r
+	}
+}
+
+// checkInclude checks that every include path names relationships of t, the
+// type of a model to marshal. Each type is checked once.
+func (s *marshalState) checkInclude(t reflect.Type) error {
+	if s.opts.include == nil || s.checked[t] {
+		return nil
+	}
+
+	for _, path := range s.opts.includePaths {
+		if err := checkIncludePath(t, path); err != nil {
+			return err
+		}
+	}
+
+	if s.checked == nil {
+		s.checked = map[reflect.Type]bool{}
+	}
+	s.checked[t] = true
+	return nil
+}
+
+// checkIncludePath checks that path names relationships of t. A name may be
+// a relationship of any of the models a polyrelation links to.
+func checkIncludePath(t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	types := []reflect.Type{t}
+	for _, name := range strings.Split(path, ".") {
+		var related []reflect.Type
+		for _, t := range types {
+			for _, field := range typePlanFor(t).fields {
+				if field.name != name ||
+					(field.annotation != annotationRelation && field.annotation != annotationPolyRelation) {
+					continue
+				}
+				related = append(related, relatedModelTypes(field)...)
+			}
+		}
+
+		if len(related) == 0 {
+			return &IncludeError{Path: path, Relationship: name}
+		}
+		types = related
+	}
+
+	return nil
+}
+
+// follows reports whether the related resources of the relationship name of
+// the resource being visited are visited, and sideloaded, in full. Under the
+// include paths, only those of the relationships on a path are.
+func (s *marshalState) follows(name string, sideload bool) bool {
+	if !sideload || s.include == nil {
+		return true
+	}
+	_, ok := s.include[name]
+	return ok
+}
+
+// enter makes the include tree of the relationship name current, while its
+// related resources are visited. It returns a function restoring the tree of
+// the resource being visited.
+func (s *marshalState) enter(name string) func() {
+	if s.include == nil {
+		return func() {}
+	}
+
+	parent := s.include
+	s.include = parent[name]
+	return func() {
+		s.include = parent
+	}
+}
+
+// visitRelatedModel visits model, related to the resource being visited
+// through the relationship name: in full when follow is set, and for its
+// resource identifier only otherwise.
+func visitRelatedModel(model interface{}, name string, follow bool, included *map[string]*Node,
+	sideload bool, state *marshalState) (*Node, error) {
+	if !follow {
+		return visitModelIdentifier(model)
+	}
+
+	defer state.enter(name)()
+	return visitModelNode(model, included, sideload, state)
+}
+
+// visitModelIdentifier returns the resource identifier of model, a pointer to
+// a struct with jsonapi annotations.
+func visitModelIdentifier(model interface{}) (*Node, error) {
+	value := reflect.Indirect(reflect.ValueOf(model))
+	plan := typePlanFor(value.Type())
+	if plan.err != nil {
+		return nil, plan.err
+	}
+
+	node := new(Node)
+	if plan.primary == nil {
+		return node, nil
+	}
+
+	v, ok := fieldByIndex(value, plan.primary.index)
+	if !ok {
+		return node, nil
+	}
+
+	id, err := formatID(plan.primary.kind, reflect.Indirect(v))
+	if err != nil {
+		return nil, err
+	}
+	node.Type = plan.primary.name
+	node.ID = id
+	return node, nil
+}
+
+// visitRelationshipLinks writes the relationship field of model with its
+// links and meta only, as the OffPathLinksOnly mode requires. relLinks and
+// relMeta, when nil, are asked of model.
+func visitRelationshipLinks(model interface{}, field *fieldPlan, node *Node, relLinks *Links, relMeta *Meta) {
+	if relLinks == nil {
+		if linkableModel, ok := model.(RelationshipLinkable); ok {
+			relLinks = linkableModel.JSONAPIRelationshipLinks(field.name)
+		}
+	}
+	if relMeta == nil {
+		if metableModel, ok := model.(RelationshipMetable); ok {
+			relMeta = metableModel.JSONAPIRelationshipMeta(field.name)
+		}
+	}
+
+	if relLinks == nil && relMeta == nil {
+		return
+	}
+	node.Relationships[field.name] = &RelationshipLinksNode{Links: relLinks, Meta: relMeta}
+}
@@ -0,0 +1,176 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestInclude(t *testing.T) {
+	payload, err := Marshal(testOrderedBlog(), Include("current_post.comments"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := payload.(*OnePayload)
+
+	if e, a := []string{"posts,1", "comments,10", "comments,2"}, includedKeys(one.Included); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected included %v, got %v", e, a)
+	}
+
+	// The posts relationship is off the path: linked, but not sideloaded
+	posts := one.Data.Relationships["posts"].(*RelationshipManyNode)
+	if e, a := []string{"posts,2", "posts,1"}, includedKeys(posts.Data); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected posts linkage %v, got %v", e, a)
+	}
+	if posts.Links == nil || posts.Meta == nil {
+		t.Fatalf("Expected the links and meta of posts to be kept, got %+v", posts)
+	}
+	if len(posts.Data[0].Attributes) != 0 {
+		t.Fatalf("Expected a resource identifier, got %+v", posts.Data[0])
+	}
+}
+
+func TestInclude_none(t *testing.T) {
+	payload, err := Marshal([]*Blog{testOrderedBlog()}, Include())
+	if err != nil {
+		t.Fatal(err)
+	}
+	many := payload.(*ManyPayload)
+
+	if len(many.Included) != 0 {
+		t.Fatalf("Expected nothing to be included, got %v", includedKeys(many.Included))
+	}
+	current := many.Data[0].Relationships["current_post"].(*RelationshipOneNode)
+	if current.Data == nil || current.Data.Type != "posts" || current.Data.ID != "1" {
+		t.Fatalf("Expected the current_post linkage, got %+v", current.Data)
+	}
+}
+
+func TestInclude_cycles(t *testing.T) {
+	author := &Author{ID: "1", Name: "Jane"}
+	first := &Novel{ID: "1", Title: "First", Author: author}
+	second := &Novel{ID: "2", Title: "Second", Author: author}
+	first.Sequel = second
+	author.Novels = []*Novel{first, second}
+
+	library := &Library{
+		ID:      "1",
+		Curator: ToOne[Author]{Data: author},
+		Novels:  ToMany[Novel]{Data: []*Novel{second}},
+	}
+
+	payload, err := Marshal(library, Include("curator.novels"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := payload.(*OnePayload)
+
+	if e, a := []string{"authors,1", "novels,2", "novels,1"}, includedKeys(one.Included); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected included %v, got %v", e, a)
+	}
+
+	novels := one.Data.Relationships["novels"].(*RelationshipManyNode)
+	if e, a := []string{"novels,2"}, includedKeys(novels.Data); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected novels linkage %v, got %v", e, a)
+	}
+
+	// The sequel of the first novel is off the path, and only linked to the
+	// second novel, which the path includes through the curator
+	sequel := one.Included[2].Relationships["sequel"].(*RelationshipOneNode)
+	if sequel.Data.Type != "novels" || sequel.Data.ID != "2" || len(sequel.Data.Attributes) != 0 {
+		t.Fatalf("Expected a resource identifier, got %+v", sequel.Data)
+	}
+}
+
+func TestInclude_linksOnly(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := MarshalPayload(out, testOrderedBlog(), Include("current_post"), IncludeOffPath(OffPathLinksOnly)); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Data struct {
+			Relationships map[string]map[string]json.RawMessage `json:"relationships"`
+		} `json:"data"`
+		Included []struct {
+			Type          string                     `json:"type"`
+			Relationships map[string]json.RawMessage `json:"relationships"`
+		} `json:"included"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := doc.Data.Relationships["posts"]
+	if _, ok := posts["data"]; ok {
+		t.Fatalf("Expected no linkage for posts, got %s", posts["data"])
+	}
+	if _, ok := posts["links"]; !ok {
+		t.Fatalf("Expected the links of posts, got %v", posts)
+	}
+	if _, ok := doc.Data.Relationships["current_post"]["data"]; !ok {
+		t.Fatal("Expected the linkage of current_post")
+	}
+
+	if len(doc.Included) != 1 || doc.Included[0].Type != "posts" {
+		t.Fatalf("Expected the current post only to be included, got %+v", doc.Included)
+	}
+	// Comments have neither links nor meta
+	if _, ok := doc.Included[0].Relationships["comments"]; ok {
+		t.Fatalf("Expected the comments relationship to be left out, got %s", doc.Included[0].Relationships["comments"])
+	}
+}
+
+func TestInclude_invalidPath(t *testing.T) {
+	for _, models := range []interface{}{testOrderedBlog(), []*Blog{}} {
+		_, err := Marshal(models, Include("posts.comments", "current_post.author"))
+
+		var ie *IncludeError
+		if !errors.As(err, &ie) {
+			t.Fatalf("Expected an *IncludeError, got %v", err)
+		}
+		if !errors.Is(err, ErrInvalidInclude) {
+			t.Fatalf("Expected ErrInvalidInclude, got %v", err)
+		}
+		if ie.Path != "current_post.author" || ie.Relationship != "author" {
+			t.Fatalf("Unexpected error %+v", ie)
+		}
+
+		obj := ie.ErrorObject()
+		if obj.Status != "400" || obj.Source == nil || obj.Source.Parameter != "include" {
+			t.Fatalf("Unexpected error object %+v", obj)
+		}
+	}
+}
+
+func TestInclude_attributeIsNotAPath(t *testing.T) {
+	if _, err := Marshal(testOrderedBlog(), Include("title")); !errors.Is(err, ErrInvalidInclude) {
+		t.Fatalf("Expected ErrInvalidInclude, got %v", err)
+	}
+}
+
+func TestInclude_stream(t *testing.T) {
+	out := new(bytes.Buffer)
+	enc := NewStreamEncoder(out, Include("current_post"))
+	if err := enc.Encode(testOrderedBlog()); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc ManyPayload
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if e, a := []string{"posts,1"}, includedKeys(doc.Included); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected included %v, got %v", e, a)
+	}
+
+	enc = NewStreamEncoder(new(bytes.Buffer), Include("authors"))
+	if err := enc.Encode(testOrderedBlog()); !errors.Is(err, ErrInvalidInclude) {
+		t.Fatalf("Expected ErrInvalidInclude, got %v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CoercionKind is the kind of a Coercion.
+type CoercionKind int
+
+const (
+	// CoerceStringToNumber is a string holding a number, e.g. "42",
+	// unmarshaled into a numeric field.
+	CoerceStringToNumber CoercionKind = iota
+	// CoerceNumberToString is a number unmarshaled into a string field.
+	CoerceNumberToString
+	// CoerceStringToBool is the string "true" or "false" unmarshaled into a
+	// bool field.
+	CoerceStringToBool
+	// CoerceBoolToString is a boolean unmarshaled into a string field.
+	CoerceBoolToString
+	// CoerceNumericID is a resource id sent as a number rather than a string.
+	CoerceNumericID
+	// CoerceValueToArray is a single value unmarshaled into a slice or array
+	// field, as its only element.
+	CoerceValueToArray
+	// CoerceArrayToValue is an array of one element unmarshaled into a field
+	// that is not a slice or an array.
+	CoerceArrayToValue
+	// CoerceTypeCase is a resource type that only matches the type of a model
+	// when compared case-insensitively, e.g. "Posts" for "posts".
+	CoerceTypeCase
+)
+
+var coercionKindNames = map[CoercionKind]string{
+	CoerceStringToNumber: "string to number",
+	CoerceNumberToString: "number to string",
+	CoerceStringToBool:   "string to bool",
+	CoerceBoolToString:   "bool to string",
+	CoerceNumericID:      "numeric id",
+	CoerceValueToArray:   "value to array",
+	CoerceArrayToValue:   "array to value",
+	CoerceTypeCase:       "type case",
+}
+
+func (k CoercionKind) String() string {
+	if name, ok := coercionKindNames[k]; ok {
+		return name
+	}
+	return "CoercionKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Coercion describes a value of the document that did not have the type its
+// struct field or the JSON API spec expects, and was converted by the Lenient
+// option.
+type Coercion struct {
+	// Pointer is the JSON Pointer (RFC6901) of the value, e.g.
+	// "/data/attributes/age".
+	Pointer string
+	// Kind is the kind of conversion applied.
+	Kind CoercionKind
+	// Value is the value as found in the document. Numbers are json.Number.
+	Value interface{}
+}
+
+// Lenient makes unmarshaling accept, for the sake of legacy clients, a few
+// well-defined deviations from the types the model and the JSON API spec
+// expect, each of which is described by a CoercionKind:
+//
+//   - strings holding a number for numeric attributes, and numbers for string
+//     attributes;
+//   - the strings "true" and "false" for bool attributes, and booleans for
+//     string attributes;
+//   - resource ids sent as numbers;
+//   - single values for slice and array attributes, and arrays of one element
+//     for any other attribute;
+//   - resource types that only differ in case from the type of a model.
+//
+// hook, when not nil, is called with each coercion applied, e.g. to track the
+// clients that still rely on them.
+func Lenient(hook func(Coercion)) UnmarshalOption {
+	return func(o *unmarshalOptions) {
+		o.lenient = true
+		o.coercionHook = hook
+	}
+}
+
+// coerced records the coercion c.
+func (o *unmarshalOptions) coerced(c Coercion) {
+	if o.coercionHook != nil {
+		o.coercionHook(c)
+	}
+}
+
+// coerceDocument applies the lenient coercions of the resource ids and types
+// to the document data, whose model type is t, if known.
+func coerceDocument(data []byte, t reflect.Type, opts *unmarshalOptions) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := decodeJSON(bytes.NewReader(data), &doc); err != nil {
+		return nil, err
+	}
+
+	c := newResourceCoercer(t, opts)
+	switch primary := doc["data"].(type) {
+	case map[string]interface{}:
+		c.resource(primary, "/data")
+	case []interface{}:
+		c.resources(primary, "/data")
+	}
+	if included, ok := doc["included"].([]interface{}); ok {
+		c.resources(included, "/included")
+	}
+
+	return json.Marshal(doc)
+}
+
+// resourceCoercer applies the lenient coercions of the resource ids and types
+// of a document.
+type resourceCoercer struct {
+	// types holds the resource types of the models reachable from the model
+	// of the document, sorted.
+	types []string
+	opts  *unmarshalOptions
+}
+
+func newResourceCoercer(t reflect.Type, opts *unmarshalOptions) *resourceCoercer {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	c := &resourceCoercer{opts: opts}
+	if t != nil && t.Kind() == reflect.Struct {
+		for name := range reachableTypes(t) {
+			c.types = append(c.types, name)
+		}
+		sort.Strings(c.types)
+	}
+	return c
+}
+
+// resources coerces each resource of the array v, found at pointer.
+func (c *resourceCoercer) resources(v []interface{}, pointer string) {
+	for i, r := range v {
+		if r, ok := r.(map[string]interface{}); ok {
+			c.resource(r, pointer+"/"+strconv.Itoa(i))
+		}
+	}
+}
+
+// resource coerces the resource object r, found at pointer, along with the
+// linkage of its relationships.
+func (c *resourceCoercer) resource(r map[string]interface{}, pointer string) {
+	c.identifier(r, pointer)
+
+	relationships, _ := r["relationships"].(map[string]interface{})
+	for _, name := range sortedKeys(relationships) {
+		relationship, ok := relationships[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		dataPointer := pointer + "/relationships/" + escapePointerToken(name) + "/data"
+		switch data := relationship["data"].(type) {
+		case map[string]interface{}:
+			c.identifier(data, dataPointer)
+		case []interface{}:
+			for i, id := range data {
+				if id, ok := id.(map[string]interface{}); ok {
+					c.identifier(id, dataPointer+"/"+strconv.Itoa(i))
+				}
+			}
+		}
+	}
+}
+
+// identifier coerces the id and type of r, a resource object or a resource
+// identifier object found at pointer.
+func (c *resourceCoercer) identifier(r map[string]interface{}, pointer string) {
+	if id, ok := r["id"].(json.Number); ok {
+		c.opts.coerced(Coercion{Pointer: pointer + "/id", Kind: CoerceNumericID, Value: id})
+		r["id"] = id.String()
+	}
+
+	typ, ok := r["type"].(string)
+	if !ok {
+		return
+	}
+	for _, name := range c.types {
+		if name == typ {
+			return
+		}
+	}
+	for _, name := range c.types {
+		if strings.EqualFold(name, typ) {
+			c.opts.coerced(Coercion{Pointer: pointer + "/type", Kind: CoerceTypeCase, Value: typ})
+			r["type"] = name
+			return
+		}
+	}
+}
+
+// coerceAttribute applies the lenient coercions of attribute, the value of an
+// attribute found at loc, to the type t of its struct field.
+func coerceAttribute(attribute interface{}, t reflect.Type, state *unmarshalState, loc location) interface{} {
+	if !state.opts.lenient || attribute == nil {
+		return attribute
+	}
+
+	coerced := func(kind CoercionKind, value interface{}) interface{} {
+		state.opts.coerced(Coercion{Pointer: loc.pointer, Kind: kind, Value: attribute})
+		return value
+	}
+
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Bytes are unmarshaled from a base64 string
+			return attribute
+		}
+		if _, ok := attribute.([]interface{}); !ok {
+			return coerced(CoerceValueToArray, []interface{}{attribute})
+		}
+		return attribute
+	case reflect.Map, reflect.Struct, reflect.Interface:
+		return attribute
+	}
+
+	if elements, ok := attribute.([]interface{}); ok && len(elements) == 1 {
+		attribute = coerced(CoerceArrayToValue, elements[0])
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if s, ok := attribute.(string); ok && isJSONNumber(strings.TrimSpace(s)) {
+			return coerced(CoerceStringToNumber, json.Number(strings.TrimSpace(s)))
+		}
+	case reflect.Bool:
+		if s, ok := attribute.(string); ok {
+			switch strings.ToLower(strings.TrimSpace(s)) {
+			case "true":
+				return coerced(CoerceStringToBool, true)
+			case "false":
+				return coerced(CoerceStringToBool, false)
+			}
+		}
+	case reflect.String:
+		switch v := attribute.(type) {
+		case json.Number:
+			return coerced(CoerceNumberToString, v.String())
+		case bool:
+			return coerced(CoerceBoolToString, strconv.FormatBool(v))
+		}
+	}
+
+	return attribute
+}
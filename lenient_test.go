@@ -0,0 +1,136 @@
+package jsonapi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const legacyDevicePayload = `{
+	"data": {
+		"type": "Devices",
+		"id": 7,
+		"attributes": {
+			"battery": "42",
+			"level": " 0.5 ",
+			"charging": "TRUE",
+			"model": 3310,
+			"rooted": false,
+			"owner": ["jane"],
+			"tags": "phone",
+			"ports": ["1", 2],
+			"enabled": "false"
+		},
+		"relationships": {
+			"author": {"data": {"type": "authors", "id": 1}}
+		}
+	},
+	"included": [
+		{"type": "AUTHORS", "id": 1, "attributes": {"name": "Jane"}}
+	]
+}`
+
+func TestUnmarshalPayload_lenient(t *testing.T) {
+	var coercions []Coercion
+	device := new(Device)
+	err := UnmarshalPayload(strings.NewReader(legacyDevicePayload), device, Lenient(func(c Coercion) {
+		coercions = append(coercions, c)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	level := 0.5
+	enabled := NewNullableAttrWithValue(false)
+	expected := &Device{
+		ID:       7,
+		Battery:  42,
+		Level:    &level,
+		Charging: true,
+		Model:    "3310",
+		Rooted:   "false",
+		Owner:    "jane",
+		Tags:     []string{"phone"},
+		Ports:    []int{1, 2},
+		Enabled:  enabled,
+		Author:   &Author{ID: "1", Name: "Jane"},
+	}
+	if !reflect.DeepEqual(device, expected) {
+		t.Fatalf("Expected\n%+v\ngot\n%+v", expected, device)
+	}
+
+	kinds := map[string]CoercionKind{}
+	for _, c := range coercions {
+		kinds[c.Pointer] = c.Kind
+	}
+	expectedKinds := map[string]CoercionKind{
+		"/data/id":                           CoerceNumericID,
+		"/data/type":                         CoerceTypeCase,
+		"/data/relationships/author/data/id": CoerceNumericID,
+		"/included/0/id":                     CoerceNumericID,
+		"/included/0/type":                   CoerceTypeCase,
+		"/data/attributes/battery":           CoerceStringToNumber,
+		"/data/attributes/level":             CoerceStringToNumber,
+		"/data/attributes/charging":          CoerceStringToBool,
+		"/data/attributes/model":             CoerceNumberToString,
+		"/data/attributes/rooted":            CoerceBoolToString,
+		"/data/attributes/owner":             CoerceArrayToValue,
+		"/data/attributes/tags":              CoerceValueToArray,
+		"/data/attributes/ports/0":           CoerceStringToNumber,
+		"/data/attributes/enabled":           CoerceStringToBool,
+	}
+	if !reflect.DeepEqual(kinds, expectedKinds) {
+		t.Fatalf("Expected coercions\n%v\ngot\n%v", expectedKinds, kinds)
+	}
+}
+
+func TestUnmarshalPayload_lenientDisabled(t *testing.T) {
+	in := `{"data": {"type": "devices", "id": "7", "attributes": {"battery": "42"}}}`
+	err := UnmarshalPayload(strings.NewReader(in), new(Device))
+	if !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("Expected ErrInvalidType, got %v", err)
+	}
+
+	in = `{"data": {"type": "devices", "id": 7}}`
+	if err := UnmarshalPayload(strings.NewReader(in), new(Device)); err == nil {
+		t.Fatal("Expected a numeric id to be rejected")
+	}
+}
+
+func TestUnmarshalPayload_lenientInvalid(t *testing.T) {
+	in := `{"data": {"type": "devices", "id": "7", "attributes": {"battery": "many", "charging": "yes"}}}`
+	err := UnmarshalPayload(strings.NewReader(in), new(Device), Lenient(nil), CollectErrors())
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", err)
+	}
+}
+
+func TestUnmarshalEach_lenient(t *testing.T) {
+	in := `{"data": [{"type": "Devices", "id": 1, "attributes": {"battery": "10"}}, {"type": "devices", "id": 2}]}`
+
+	var ids []int
+	var coercions int
+	_, err := UnmarshalEach(strings.NewReader(in), func(d *Device) error {
+		ids = append(ids, d.ID)
+		return nil
+	}, Lenient(func(Coercion) { coercions++ }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ids, []int{1, 2}) || coercions != 4 {
+		t.Fatalf("Unexpected ids %v and %d coercions", ids, coercions)
+	}
+}
+
+func TestCoercionKindString(t *testing.T) {
+	if e, a := "numeric id", CoerceNumericID.String(); e != a {
+		t.Fatalf("Expected %q, got %q", e, a)
+	}
+	if e, a := "CoercionKind(42)", CoercionKind(42).String(); e != a {
+		t.Fatalf("Expected %q, got %q", e, a)
+	}
+}
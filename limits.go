@@ -0,0 +1,387 @@
+package jsonapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ErrLimitExceeded is wrapped by every *LimitError, so that documents
+// exceeding a limit can be detected with `errors.Is`.
+var ErrLimitExceeded = errors.New("document exceeds a limit")
+
+// Limits bounds the size of the documents that are unmarshaled or marshaled,
+// to protect servers from hostile or oversized documents. A zero field means
+// no limit. Limits are set with the UnmarshalLimits and MarshalLimits options;
+// a document exceeding one of them is rejected with a *LimitError.
+type Limits struct {
+	// MaxData is the maximum number of resources of the primary data of a
+	// collection document.
+	MaxData int
+	// MaxIncluded is the maximum number of resources of the "included"
+	// array.
+	MaxIncluded int
+	// MaxRelationshipData is the maximum number of resources a to-many
+	// relationship links to.
+	MaxRelationshipData int
+	// MaxDepth is the maximum nesting depth of the arrays and objects of an
+	// attribute value. Scalar values have a depth of 0, [1] a depth of 1 and
+	// {"a": [1]} a depth of 2.
+	MaxDepth int
+	// MaxAttributeBytes is the maximum size, in bytes, of the JSON encoding of
+	// an attribute value, as found in the document.
+	MaxAttributeBytes int
+}
+
+// check returns a *LimitError for the limit named name, whose value is max,
+// if n exceeds it.
+func (l Limits) check(name string, max, n int, pointer string) error {
+	if max > 0 && n > max {
+		return &LimitError{Pointer: pointer, Limit: name, Max: max}
+	}
+	return nil
+}
+
+// checkPayload checks the number of resources of a document against the
+// limits. many is set for collection documents. The attribute values, which
+// are only known once encoded, are checked by a limitScanner as the document
+// is written.
+func (l Limits) checkPayload(data []*Node, included []*Node, many bool) error {
+	if l == (Limits{}) {
+		return nil
+	}
+
+	if many {
+		if err := l.check("MaxData", l.MaxData, len(data), "/data"); err != nil {
+			return err
+		}
+	}
+	for i, n := range data {
+		pointer := "/data"
+		if many {
+			pointer += "/" + strconv.Itoa(i)
+		}
+		if err := l.checkNode(n, pointer); err != nil {
+			return err
+		}
+	}
+
+	if err := l.check("MaxIncluded", l.MaxIncluded, len(included), "/included"); err != nil {
+		return err
+	}
+	for i, n := range included {
+		if err := l.checkNode(n, "/included/"+strconv.Itoa(i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkNode checks the relationships of the resource n, found at pointer,
+// against the limits.
+func (l Limits) checkNode(n *Node, pointer string) error {
+	if n == nil || l.MaxRelationshipData == 0 {
+		return nil
+	}
+
+	for _, name := range sortedKeys(n.Relationships) {
+		count := 0
+		if relationship, ok := n.Relationships[name].(*RelationshipManyNode); ok {
+			count = len(relationship.Data)
+		}
+
+		relPointer := pointer + "/relationships/" + escapePointerToken(name) + "/data"
+		if err := l.check("MaxRelationshipData", l.MaxRelationshipData, count, relPointer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// limitReader checks the document read from r against the limits as it is
+// read, so that a document exceeding them is rejected before it is wholly
+// read, let alone decoded.
+type limitReader struct {
+	r       io.Reader
+	scanner *limitScanner
+	err     error
+}
+
+// newLimitReader returns a reader of the document read from in, which fails
+// with a *LimitError as soon as the document exceeds limits. relationship is
+// set for relationship documents, whose data is resource linkage.
+func newLimitReader(in io.Reader, limits Limits, relationship bool) io.Reader {
+	if limits == (Limits{}) {
+		return in
+	}
+	return &limitReader{r: in, scanner: newLimitScanner(limits, relationship)}
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.r.Read(p)
+	if scanErr := r.scanner.scan(p[:n]); scanErr != nil {
+		// None of the bytes is handed over, so that the decoder cannot
+		// complete a value out of them
+		r.err = scanErr
+		return 0, scanErr
+	}
+	return n, err
+}
+
+// limitScanner checks a JSON document against the limits one byte at a time,
+// keeping track of the members and array elements it is in, so that the
+// document never needs to be held, or decoded, as a whole.
+type limitScanner struct {
+	limits       Limits
+	relationship bool
+
+	// n is the number of bytes scanned so far.
+	n int
+	// stack holds the objects and arrays the scanner is in.
+	stack []limitFrame
+
+	inString bool
+	escaped  bool
+	// inLiteral is set within a number, true, false or null.
+	inLiteral bool
+	// key holds the raw bytes of the object key being read, if it is needed
+	// to tell where the scanner is.
+	key     []byte
+	readKey bool
+
+	// attr is set within an attribute value, whose size and depth are
+	// limited.
+	attr *limitAttribute
+}
+
+// limitFrame is an object or array the limitScanner is in.
+type limitFrame struct {
+	object bool
+	// expectKey is set when the next string of an object is a member name.
+	expectKey bool
+	// key is the name of the current member of an object, when known.
+	key string
+	// elements is the number of elements of an array started so far.
+	elements int
+}
+
+// limitAttribute is the attribute value a limitScanner is in.
+type limitAttribute struct {
+	pointer string
+	// base is the length of the stack of the scanner at the start of the
+	// value, whose depth is counted from there.
+	base int
+	// start is the offset of the first byte of the value.
+	start int
+}
+
+// limitKeyDepth is the depth of the deepest object whose member names tell
+// where the scanner is: the relationship objects of the included resources.
+const limitKeyDepth = 5
+
+func newLimitScanner(limits Limits, relationship bool) *limitScanner {
+	return &limitScanner{limits: limits, relationship: relationship}
+}
+
+// scan checks the next bytes of the document.
+func (s *limitScanner) scan(p []byte) error {
+	for _, c := range p {
+		s.n++
+		if err := s.step(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *limitScanner) step(c byte) error {
+	if s.inString {
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.inString = false
+			if s.readKey {
+				s.readKey = false
+				s.top().key = decodeKey(s.key)
+				s.key = s.key[:0]
+			}
+		}
+		if s.inString && s.readKey {
+			s.key = append(s.key, c)
+		}
+		return s.checkAttributeBytes()
+	}
+
+	switch c {
+	case ' ', '\t', '\n', '\r':
+		s.inLiteral = false
+		return nil
+	}
+
+	if s.attr != nil && len(s.stack) == s.attr.base && (c == ',' || c == '}') {
+		// The attribute value ends with the member holding it
+		s.attr = nil
+	}
+	if err := s.checkAttributeBytes(); err != nil {
+		return err
+	}
+
+	top := s.top()
+	switch c {
+	case ':':
+		s.inLiteral = false
+		return nil
+	case ',':
+		s.inLiteral = false
+		if top != nil && top.object {
+			top.expectKey = true
+		}
+		return nil
+	case '}', ']':
+		s.inLiteral = false
+		if top != nil {
+			s.stack = s.stack[:len(s.stack)-1]
+		}
+		return nil
+	}
+
+	if top != nil && top.object && top.expectKey {
+		if c == '"' {
+			top.expectKey = false
+			s.inString = true
+			s.readKey = len(s.stack) <= limitKeyDepth
+		}
+		return nil
+	}
+
+	if s.inLiteral {
+		return nil
+	}
+
+	// A value starts
+	if err := s.startValue(top); err != nil {
+		return err
+	}
+
+	switch c {
+	case '{', '[':
+		s.stack = append(s.stack, limitFrame{object: c == '{', expectKey: c == '{'})
+		if s.attr != nil {
+			return s.limits.check("MaxDepth", s.limits.MaxDepth, len(s.stack)-s.attr.base, s.attr.pointer)
+		}
+	case '"':
+		s.inString = true
+	default:
+		s.inLiteral = true
+	}
+	return nil
+}
+
+// startValue counts the value starting in top, checking the array or
+// attribute it starts.
+func (s *limitScanner) startValue(top *limitFrame) error {
+	if top == nil || s.attr != nil {
+		return nil
+	}
+
+	if top.object {
+		// An attribute value: data.attributes.name
+		if len(s.stack) < 2 || s.stack[len(s.stack)-2].key != "attributes" {
+			return nil
+		}
+		if pointer, ok := s.resource(len(s.stack) - 2); ok {
+			s.attr = &limitAttribute{
+				pointer: pointer + "/attributes/" + escapePointerToken(top.key),
+				base:    len(s.stack),
+				start:   s.n,
+			}
+		}
+		return nil
+	}
+
+	top.elements++
+
+	if len(s.stack) == 2 {
+		switch s.stack[0].key {
+		case "data":
+			if s.relationship {
+				return s.limits.check("MaxRelationshipData", s.limits.MaxRelationshipData, top.elements, "/data")
+			}
+			return s.limits.check("MaxData", s.limits.MaxData, top.elements, "/data")
+		case "included":
+			return s.limits.check("MaxIncluded", s.limits.MaxIncluded, top.elements, "/included")
+		}
+		return nil
+	}
+
+	// The linkage of a to-many relationship: data.relationships.name.data
+	r := len(s.stack) - 4
+	if r < 1 || s.stack[r].key != "relationships" || s.stack[r+2].key != "data" {
+		return nil
+	}
+	if pointer, ok := s.resource(r); ok {
+		pointer += "/relationships/" + escapePointerToken(s.stack[r+1].key) + "/data"
+		return s.limits.check("MaxRelationshipData", s.limits.MaxRelationshipData, top.elements, pointer)
+	}
+	return nil
+}
+
+// resource returns the JSON Pointer of the resource object at index i of the
+// stack, if it is one of the primary data or of the "included" array.
+func (s *limitScanner) resource(i int) (string, bool) {
+	if s.relationship || !s.stack[i].object || !s.stack[0].object {
+		return "", false
+	}
+
+	name := s.stack[0].key
+	switch {
+	case i == 1 && name == "data":
+		return "/data", true
+	case i == 2 && !s.stack[1].object && (name == "data" || name == "included"):
+		return "/" + name + "/" + strconv.Itoa(s.stack[1].elements-1), true
+	}
+	return "", false
+}
+
+// checkAttributeBytes checks the size of the attribute value the scanner is
+// in, up to the current byte.
+func (s *limitScanner) checkAttributeBytes() error {
+	if s.attr == nil {
+		return nil
+	}
+	return s.limits.check("MaxAttributeBytes", s.limits.MaxAttributeBytes, s.n-s.attr.start+1, s.attr.pointer)
+}
+
+func (s *limitScanner) top() *limitFrame {
+	if len(s.stack) == 0 {
+		return nil
+	}
+	return &s.stack[len(s.stack)-1]
+}
+
+// decodeKey returns the member name whose JSON encoding, without its quotes,
+// is raw.
+func decodeKey(raw []byte) string {
+	var key string
+	if err := json.Unmarshal(append(append([]byte{'"'}, raw...), '"'), &key); err != nil {
+		return string(raw)
+	}
+	return key
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := mapKeys(m)
+	sort.Strings(keys)
+	return keys
+}
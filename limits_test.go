@@ -0,0 +1,271 @@
+package jsonapi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const limitsPayload = `{
+	"data": [
+		{"type": "blogs", "id": "1", "attributes": {"title": "First"}, "relationships": {"posts": {"data": [{"type": "posts", "id": "1"}, {"type": "posts", "id": "2"}]}}},
+		{"type": "blogs", "id": "2", "attributes": {"title": "Second"}}
+	],
+	"included": [
+		{"type": "posts", "id": "1", "attributes": {"title": "Foo"}},
+		{"type": "posts", "id": "2", "attributes": {"title": "Bar"}}
+	]
+}`
+
+func TestUnmarshalLimits(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		payload string
+		limits  Limits
+		pointer string
+		limit   string
+	}{
+		{"data", limitsPayload, Limits{MaxData: 1}, "/data", "MaxData"},
+		{"included", limitsPayload, Limits{MaxIncluded: 1}, "/included", "MaxIncluded"},
+		{"relationship data", limitsPayload, Limits{MaxRelationshipData: 1}, "/data/0/relationships/posts/data", "MaxRelationshipData"},
+		{"attribute bytes", limitsPayload, Limits{MaxAttributeBytes: 7}, "/data/1/attributes/title", "MaxAttributeBytes"},
+		{
+			"depth",
+			`{"data": [{"type": "collections", "id": "1", "attributes": {"ints": [1], "grid": [[1, 2], [3]]}}]}`,
+			Limits{MaxDepth: 1},
+			"/data/0/attributes/grid",
+			"MaxDepth",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			typ := reflect.TypeOf(new(Blog))
+			if strings.Contains(tc.payload, "collections") {
+				typ = reflect.TypeOf(new(Collections))
+			}
+
+			_, err := UnmarshalManyPayload(strings.NewReader(tc.payload), typ, UnmarshalLimits(tc.limits), CollectErrors())
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("Expected ErrLimitExceeded, got %v", err)
+			}
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("Expected a *LimitError, got %T", err)
+			}
+			if limitErr.Pointer != tc.pointer || limitErr.Limit != tc.limit {
+				t.Fatalf("Unexpected error %+v", limitErr)
+			}
+		})
+	}
+}
+
+func TestUnmarshalLimits_withinLimits(t *testing.T) {
+	limits := Limits{MaxData: 2, MaxIncluded: 2, MaxRelationshipData: 2, MaxDepth: 1, MaxAttributeBytes: 8}
+
+	blogs, err := UnmarshalManyPayload(strings.NewReader(limitsPayload), reflect.TypeOf(new(Blog)), UnmarshalLimits(limits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blogs) != 2 {
+		t.Fatalf("Expected 2 blogs, got %d", len(blogs))
+	}
+
+	in := `{"data": {"type": "blogs", "id": "1", "attributes": {"title": "First"}}}`
+	if err := UnmarshalPayload(strings.NewReader(in), new(Blog), UnmarshalLimits(limits)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnmarshalLimits_stream(t *testing.T) {
+	// The whole document is read at once, and rejected before any blog is
+	// handed over
+	count := 0
+	_, err := UnmarshalEach(strings.NewReader(limitsPayload), func(blog *Blog) error {
+		count++
+		return nil
+	}, UnmarshalLimits(Limits{MaxData: 1}))
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxData" {
+		t.Fatalf("Expected a MaxData *LimitError, got %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("Expected no blog before the limit, got %d", count)
+	}
+
+	_, err = UnmarshalEach(strings.NewReader(limitsPayload), func(blog *Blog) error {
+		return nil
+	}, UnmarshalLimits(Limits{MaxIncluded: 1}))
+	if !errors.As(err, &limitErr) || limitErr.Pointer != "/included" {
+		t.Fatalf("Expected a MaxIncluded *LimitError, got %v", err)
+	}
+}
+
+func TestMarshalLimits(t *testing.T) {
+	blog := &Blog{
+		ID:    1,
+		Title: "First",
+		Posts: []*Post{{ID: 1, Title: "Foo"}, {ID: 2, Title: "Bar"}},
+	}
+
+	for _, tc := range []struct {
+		desc    string
+		model   interface{}
+		limits  Limits
+		pointer string
+	}{
+		{"included", blog, Limits{MaxIncluded: 1}, "/included"},
+		{"relationship data", blog, Limits{MaxRelationshipData: 1}, "/data/relationships/posts/data"},
+		{"data", []*Blog{blog, {ID: 2}}, Limits{MaxData: 1}, "/data"},
+		{"attribute bytes", []*Blog{blog}, Limits{MaxAttributeBytes: 6}, "/data/0/attributes/title"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := MarshalPayload(bytes.NewBuffer(nil), tc.model, MarshalLimits(tc.limits))
+
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("Expected a *LimitError, got %v", err)
+			}
+			if limitErr.Pointer != tc.pointer {
+				t.Fatalf("Expected pointer %q, got %q", tc.pointer, limitErr.Pointer)
+			}
+		})
+	}
+
+	// The included resources are not limited when they are not written
+	if err := MarshalPayloadWithoutIncluded(bytes.NewBuffer(nil), blog, MarshalLimits(Limits{MaxIncluded: 1})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarshalLimits_embedded(t *testing.T) {
+	blog := &Blog{ID: 1, Title: "First", Posts: []*Post{{ID: 1, Title: "Foo"}}}
+
+	err := MarshalOnePayloadEmbedded(bytes.NewBuffer(nil), blog, MarshalLimits(Limits{MaxAttributeBytes: 6}))
+
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Pointer != "/data/attributes/title" {
+		t.Fatalf("Expected a MaxAttributeBytes *LimitError, got %v", err)
+	}
+
+	if err := MarshalOnePayloadEmbedded(bytes.NewBuffer(nil), blog, MarshalLimits(Limits{MaxAttributeBytes: 7})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarshalLimits_streamEncoder(t *testing.T) {
+	enc := NewStreamEncoder(bytes.NewBuffer(nil), MarshalLimits(Limits{MaxData: 1}))
+	if err := enc.Encode(&Blog{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(&Blog{ID: 2}); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected ErrLimitExceeded, got %v", err)
+	}
+	if err := enc.Close(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected the sticky ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestLimitErrorObject(t *testing.T) {
+	for _, tc := range []struct {
+		limit  string
+		status string
+	}{
+		{"MaxIncluded", "413"},
+		{"MaxDepth", "400"},
+	} {
+		obj := (&LimitError{Pointer: "/included", Limit: tc.limit, Max: 1}).ErrorObject()
+		if obj.Status != tc.status {
+			t.Errorf("Expected status %s for %s, got %s", tc.status, tc.limit, obj.Status)
+		}
+		if obj.Source == nil || obj.Source.Pointer != "/included" {
+			t.Errorf("Unexpected source %+v", obj.Source)
+		}
+	}
+}
+
+func TestLimitScanner_depth(t *testing.T) {
+	for in, depth := range map[string]int{
+		`1`:                0,
+		`"[{"`:             0,
+		`[1]`:              1,
+		`{"a":[1]}`:        2,
+		`["\"[", [[]], 1]`: 3,
+	} {
+		doc := []byte(`{"data": {"type": "tests", "attributes": {"value": ` + in + `, "next": [[]]}}}`)
+
+		if err := newLimitScanner(Limits{MaxDepth: depth + 2}, false).scan(doc); err != nil {
+			t.Errorf("Expected %s to be within MaxDepth %d, got %v", in, depth+2, err)
+		}
+		if depth < 2 {
+			continue
+		}
+
+		err := newLimitScanner(Limits{MaxDepth: depth - 1}, false).scan(doc)
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Pointer != "/data/attributes/value" {
+			t.Errorf("Expected %s to exceed MaxDepth %d, got %v", in, depth-1, err)
+		}
+	}
+}
+
+func TestLimitScanner_attributeBytes(t *testing.T) {
+	// The size of a value excludes the whitespace around it, and counts
+	// escaped characters as written
+	doc := []byte(`{"included": [{"type": "tests", "id": "1", "attributes": {
+		"name"  :  "a\"b" ,
+		"list": [1, 2],
+		"nested": {"a": {"b": 1}}
+	}}]}`)
+
+	for _, tc := range []struct {
+		max     int
+		pointer string
+	}{
+		{15, ""},
+		{14, "/included/0/attributes/nested"},
+		{6, "/included/0/attributes/nested"},
+		{5, "/included/0/attributes/name"},
+	} {
+		err := newLimitScanner(Limits{MaxAttributeBytes: tc.max}, false).scan(doc)
+		if tc.pointer == "" {
+			if err != nil {
+				t.Errorf("Expected no error for MaxAttributeBytes %d, got %v", tc.max, err)
+			}
+			continue
+		}
+
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Pointer != tc.pointer {
+			t.Errorf("Expected %s to exceed MaxAttributeBytes %d, got %v", tc.pointer, tc.max, err)
+		}
+	}
+}
+
+func TestUnmarshalLimits_beforeReading(t *testing.T) {
+	// The document never ends: it must be rejected as it is read
+	in := io.MultiReader(strings.NewReader(`{"data": [`), new(endlessResources))
+
+	_, err := UnmarshalManyPayload(in, reflect.TypeOf(new(Blog)), UnmarshalLimits(Limits{MaxData: 100}))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxData" {
+		t.Fatalf("Expected a MaxData *LimitError, got %v", err)
+	}
+}
+
+// endlessResources reads as an endless list of resource objects.
+type endlessResources struct {
+	offset int
+}
+
+func (r *endlessResources) Read(p []byte) (int, error) {
+	const resource = `{"type": "blogs", "id": "1"},`
+	for i := range p {
+		p[i] = resource[r.offset]
+		r.offset = (r.offset + 1) % len(resource)
+	}
+	return len(p), nil
+}
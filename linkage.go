@@ -0,0 +1,263 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// ErrUnknownRelationship is returned by MarshalRelationship when the model
+// has no relationship of the given name.
+var ErrUnknownRelationship = errors.New("relationship is not defined by the model")
+
+// MarshalRelationship writes the relationship document of the relationship
+// name of model, a pointer to a struct with jsonapi annotations, as served by
+// the relationship endpoints of the JSON API spec, e.g.
+// `GET /articles/1/relationships/tags`:
+//
+//	err := jsonapi.MarshalRelationship(w, article, "tags")
+//
+// The document holds the resource linkage of the relationship as its data,
+// and the links and meta of the relationship as its top-level links and meta,
+// to which those of the TopLevelLinks and TopLevelMeta options are added. The
+// related resources are not sideloaded.
+func MarshalRelationship(w io.Writer, model interface{}, name string, opts ...MarshalOption) error {
+	value := reflect.ValueOf(model)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return ErrUnexpectedType
+	}
+
+	plan := typePlanFor(value.Elem().Type())
+	if plan.err != nil {
+		return plan.err
+	}
+
+	var field *fieldPlan
+	for _, f := range plan.fields {
+		if f.name == name && (f.annotation == annotationRelation || f.annotation == annotationPolyRelation) {
+			field = f
+			break
+		}
+	}
+	if field == nil {
+		return fmt.Errorf("%w: %q", ErrUnknownRelationship, name)
+	}
+
+	o := newMarshalOptions(opts)
+	// Only the linkage of the relationship is written: the related models are
+	// visited for their identifier, as if off an include path
+	o.include = includeTree{}
+	o.offPath = OffPathLinkage
+
+	node := new(Node)
+	if fieldValue, ok := fieldByIndex(value.Elem(), field.index); ok {
+		included := map[string]*Node{}
+		if err := visitModelNodeRelation(model, field, node, fieldValue, &included, true, newMarshalState(o)); err != nil {
+			return err
+		}
+	}
+
+	var payload interface{}
+	switch relationship := node.Relationships[name].(type) {
+	case *RelationshipOneNode:
+		one := &OnePayload{Data: relationship.Data, Links: relationship.Links, Meta: relationship.Meta}
+		if err := o.topLevel(&one.Links, &one.Meta, &one.JSONAPI); err != nil {
+			return err
+		}
+		payload = one
+	case *RelationshipManyNode:
+		many := &ManyPayload{Data: relationship.Data, Links: relationship.Links, Meta: relationship.Meta}
+		if err := o.topLevel(&many.Links, &many.Meta, &many.JSONAPI); err != nil {
+			return err
+		}
+		payload = many
+	default:
+		// An empty relationship that was omitted, or an explicit null
+		links := new(Node)
+		links.Relationships = map[string]interface{}{}
+		visitRelationshipLinks(model, field, links, nil, nil)
+
+		var relLinks *Links
+		var relMeta *Meta
+		if relationship, ok := links.Relationships[name].(*RelationshipLinksNode); ok {
+			relLinks, relMeta = relationship.Links, relationship.Meta
+		}
+
+		if isToManyField(field) {
+			many := &ManyPayload{Data: []*Node{}, Links: relLinks, Meta: relMeta}
+			if err := o.topLevel(&many.Links, &many.Meta, &many.JSONAPI); err != nil {
+				return err
+			}
+			payload = many
+		} else {
+			one := &OnePayload{Links: relLinks, Meta: relMeta}
+			if err := o.topLevel(&one.Links, &one.Meta, &one.JSONAPI); err != nil {
+				return err
+			}
+			payload = one
+		}
+	}
+
+	return writePayload(w, payload, o, true)
+}
+
+// isToManyField reports whether field is a to-many relationship.
+func isToManyField(field *fieldPlan) bool {
+	t := field.structField.Type
+	if field.isNullableRelationship {
+		t = t.Elem()
+	}
+	return field.isToMany || t.Kind() == reflect.Slice
+}
+
+// UnmarshalRelationship reads a relationship document, as sent to the
+// relationship endpoints of the JSON API spec, e.g.
+// `PATCH /articles/1/relationships/tags`, and returns the resource identifiers
+// of its data:
+//
+//	identifiers, err := jsonapi.UnmarshalRelationship(r.Body)
+//
+// A document whose data is null, clearing a to-one relationship, returns no
+// identifier. A document without data, or whose data is not made of resource
+// identifier objects, returns an *UnmarshalError wrapping ErrInvalidType.
+func UnmarshalRelationship(in io.Reader, opts ...UnmarshalOption) ([]ResourceIdentifier, error) {
+	state := newUnmarshalState(nil, newUnmarshalOptions(opts))
+
+	identifiers, _, err := unmarshalRelationshipDocument(in, nil, state)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := state.err(); err != nil {
+		return nil, err
+	}
+
+	return identifiers, nil
+}
+
+// UnmarshalRelationshipModels behaves like UnmarshalRelationship, but returns
+// a new T for each resource identifier, with only its primary field set:
+//
+//	tags, err := jsonapi.UnmarshalRelationshipModels[Tag](r.Body)
+//
+// The resources must be of the type of T; an *UnmarshalError wrapping
+// ErrUnknownType is returned otherwise. T must be a struct type with a primary
+// annotation.
+func UnmarshalRelationshipModels[T any](in io.Reader, opts ...UnmarshalOption) ([]*T, error) {
+	t := reflect.TypeOf((*T)(nil))
+	if t.Elem().Kind() != reflect.Struct {
+		return nil, ErrUnexpectedType
+	}
+	primary := typePlanFor(t.Elem()).primary
+	if primary == nil {
+		return nil, ErrTypeNotFound
+	}
+
+	state := newUnmarshalState(nil, newUnmarshalOptions(opts))
+
+	identifiers, pointers, err := unmarshalRelationshipDocument(in, t, state)
+	if err != nil {
+		return nil, err
+	}
+
+	models := make([]*T, 0, len(identifiers))
+	for i, id := range identifiers {
+		if id.Type != primary.name {
+			err := state.report(&UnmarshalError{
+				Pointer: pointers[i] + "/type",
+				Type:    t,
+				Err:     fmt.Errorf("%w: %q, expected %q", ErrUnknownType, id.Type, primary.name),
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		model := new(T)
+		if err := unmarshalNode(&Node{Type: id.Type, ID: id.ID}, reflect.ValueOf(model), state, location{pointer: pointers[i]}); err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	}
+
+	if err := state.err(); err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// relationshipDocument is a relationship document, whose data is the
+// resource linkage of a relationship.
+type relationshipDocument struct {
+	Data json.RawMessage `json:"data"`
+}
+
+// unmarshalRelationshipDocument reads the relationship document from in,
+// whose related model type is t, if known, and returns its resource
+// identifiers along with their JSON Pointers.
+func unmarshalRelationshipDocument(in io.Reader, t reflect.Type, state *unmarshalState) ([]ResourceIdentifier, []string, error) {
+	doc := new(relationshipDocument)
+
+	members, err := decodePayload(newLimitReader(in, state.opts.limits, true), doc, t, state.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := state.reportUnknownMembers(members, topLevelMembers, topLevelPointer); err != nil {
+		return nil, nil, err
+	}
+	state.reportIgnored(members, topLevelMembers, topLevelPointer)
+
+	invalid := func(pointer, detail string) error {
+		return &UnmarshalError{
+			Pointer: pointer,
+			Err:     fmt.Errorf("%w: %s", ErrInvalidType, detail),
+		}
+	}
+
+	data := bytes.TrimSpace(doc.Data)
+	var nodes []*Node
+	var pointers []string
+	switch {
+	case len(data) == 0:
+		return nil, nil, invalid("/data", "a relationship document must have data")
+	case bytes.Equal(data, []byte("null")):
+		return []ResourceIdentifier{}, []string{}, nil
+	case data[0] == '[':
+		if err := decodeJSON(bytes.NewReader(data), &nodes); err != nil {
+			return nil, nil, invalid("/data", err.Error())
+		}
+		for i := range nodes {
+			pointers = append(pointers, "/data/"+strconv.Itoa(i))
+		}
+	default:
+		node := new(Node)
+		if err := decodeJSON(bytes.NewReader(data), node); err != nil {
+			return nil, nil, invalid("/data", err.Error())
+		}
+		nodes = []*Node{node}
+		pointers = []string{"/data"}
+	}
+
+	identifiers := make([]ResourceIdentifier, 0, len(nodes))
+	for i, n := range nodes {
+		if n == nil {
+			return nil, nil, invalid(pointers[i], "resource identifier is null")
+		}
+		if n.Type == "" {
+			return nil, nil, invalid(pointers[i]+"/type", "resource identifier has no type")
+		}
+		if n.ID == "" {
+			return nil, nil, invalid(pointers[i]+"/id", "resource identifier has no id")
+		}
+		identifiers = append(identifiers, ResourceIdentifier{Type: n.Type, ID: n.ID})
+	}
+
+	return identifiers, pointers, nil
+}
@@ -0,0 +1,214 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalRelationship(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := MarshalRelationship(out, testOrderedBlog(), "posts"); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedData := []interface{}{
+		map[string]interface{}{"type": "posts", "id": "2"},
+		map[string]interface{}{"type": "posts", "id": "1"},
+	}
+	if !reflect.DeepEqual(doc["data"], expectedData) {
+		t.Fatalf("Expected data %v, got %v", expectedData, doc["data"])
+	}
+	if _, ok := doc["links"].(map[string]interface{})["related"]; !ok {
+		t.Fatalf("Expected the links of the relationship, got %v", doc["links"])
+	}
+	if _, ok := doc["meta"].(map[string]interface{})["this"]; !ok {
+		t.Fatalf("Expected the meta of the relationship, got %v", doc["meta"])
+	}
+	if _, ok := doc["included"]; ok {
+		t.Fatalf("Expected nothing to be included, got %v", doc["included"])
+	}
+}
+
+func TestMarshalRelationship_limits(t *testing.T) {
+	// The data of a relationship document is linkage, not resources
+	if err := MarshalRelationship(bytes.NewBuffer(nil), testOrderedBlog(), "posts", MarshalLimits(Limits{MaxData: 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	err := MarshalRelationship(bytes.NewBuffer(nil), testOrderedBlog(), "posts", MarshalLimits(Limits{MaxRelationshipData: 1}))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxRelationshipData" || limitErr.Pointer != "/data" {
+		t.Fatalf("Expected a MaxRelationshipData *LimitError, got %v", err)
+	}
+}
+
+func TestMarshalRelationship_toOne(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := MarshalRelationship(out, testOrderedBlog(), "current_post", TopLevelMeta(&Meta{"request_id": "abc"})); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc OnePayload
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Data == nil || doc.Data.Type != "posts" || doc.Data.ID != "1" || doc.Data.Attributes != nil {
+		t.Fatalf("Expected a resource identifier, got %+v", doc.Data)
+	}
+	if e, a := (&Meta{"detail": "extra current_post detail", "request_id": "abc"}), doc.Meta; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected meta %v, got %v", e, a)
+	}
+}
+
+func TestMarshalRelationship_empty(t *testing.T) {
+	library := &Library{ID: "1", Novels: ToMany[Novel]{Linkage: []ResourceIdentifier{{Type: "novels", ID: "7"}}}}
+
+	for _, tc := range []struct {
+		name     string
+		expected string
+	}{
+		{"founder", `{"data":null}`},
+		{"branches", `{"data":[]}`},
+		{"novels", `{"data":[{"type":"novels","id":"7"}]}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			if err := MarshalRelationship(out, library, tc.name); err != nil {
+				t.Fatal(err)
+			}
+			if a := strings.TrimSpace(out.String()); a != tc.expected {
+				t.Fatalf("Expected %s, got %s", tc.expected, a)
+			}
+		})
+	}
+}
+
+func TestMarshalRelationship_unknown(t *testing.T) {
+	for _, name := range []string{"authors", "title"} {
+		if err := MarshalRelationship(new(bytes.Buffer), testOrderedBlog(), name); !errors.Is(err, ErrUnknownRelationship) {
+			t.Fatalf("Expected ErrUnknownRelationship for %q, got %v", name, err)
+		}
+	}
+}
+
+func TestUnmarshalRelationship(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		in       string
+		expected []ResourceIdentifier
+	}{
+		{
+			"to-many",
+			`{"data": [{"type": "tags", "id": "2"}, {"type": "tags", "id": "3"}]}`,
+			[]ResourceIdentifier{{Type: "tags", ID: "2"}, {Type: "tags", ID: "3"}},
+		},
+		{
+			"to-one",
+			`{"data": {"type": "people", "id": "12"}, "meta": {"note": "reassigned"}}`,
+			[]ResourceIdentifier{{Type: "people", ID: "12"}},
+		},
+		{
+			"null",
+			`{"data": null}`,
+			[]ResourceIdentifier{},
+		},
+		{
+			"empty",
+			`{"data": []}`,
+			[]ResourceIdentifier{},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			identifiers, err := UnmarshalRelationship(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(identifiers, tc.expected) {
+				t.Fatalf("Expected %v, got %v", tc.expected, identifiers)
+			}
+		})
+	}
+}
+
+func TestUnmarshalRelationship_invalid(t *testing.T) {
+	for _, tc := range []struct {
+		in      string
+		pointer string
+	}{
+		{`{"meta": {}}`, "/data"},
+		{`{"data": "tags"}`, "/data"},
+		{`{"data": [{"type": "tags", "id": "1"}, {"id": "2"}]}`, "/data/1/type"},
+		{`{"data": {"type": "tags"}}`, "/data/id"},
+	} {
+		_, err := UnmarshalRelationship(strings.NewReader(tc.in))
+
+		var ue *UnmarshalError
+		if !errors.As(err, &ue) || !errors.Is(err, ErrInvalidType) {
+			t.Fatalf("Expected an *UnmarshalError wrapping ErrInvalidType for %s, got %v", tc.in, err)
+		}
+		if ue.Pointer != tc.pointer {
+			t.Fatalf("Expected pointer %q for %s, got %q", tc.pointer, tc.in, ue.Pointer)
+		}
+	}
+}
+
+func TestUnmarshalRelationship_limits(t *testing.T) {
+	in := `{"data": [{"type": "tags", "id": "2"}, {"type": "tags", "id": "3"}]}`
+
+	// The data of a relationship document is linkage, not resources
+	if _, err := UnmarshalRelationship(strings.NewReader(in), UnmarshalLimits(Limits{MaxData: 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := UnmarshalRelationship(strings.NewReader(in), UnmarshalLimits(Limits{MaxRelationshipData: 1}))
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "MaxRelationshipData" || limitErr.Pointer != "/data" {
+		t.Fatalf("Expected a MaxRelationshipData *LimitError, got %v", err)
+	}
+}
+
+func TestUnmarshalRelationshipModels(t *testing.T) {
+	in := `{"data": [{"type": "comments", "id": "1"}, {"type": "comments", "id": 2}]}`
+
+	var coercions []Coercion
+	comments, err := UnmarshalRelationshipModels[Comment](strings.NewReader(in), Lenient(func(c Coercion) {
+		coercions = append(coercions, c)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []*Comment{{ID: 1}, {ID: 2}}
+	if !reflect.DeepEqual(comments, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, comments)
+	}
+	if len(coercions) != 1 || coercions[0].Pointer != "/data/1/id" {
+		t.Fatalf("Expected the numeric id to be coerced, got %+v", coercions)
+	}
+}
+
+func TestUnmarshalRelationshipModels_wrongType(t *testing.T) {
+	in := `{"data": [{"type": "posts", "id": "1"}, {"type": "comments", "id": "x"}]}`
+
+	_, err := UnmarshalRelationshipModels[Comment](strings.NewReader(in), CollectErrors())
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected two errors, got %v", err)
+	}
+	if errs[0].Pointer != "/data/0/type" || !errors.Is(errs[0], ErrUnknownType) {
+		t.Fatalf("Unexpected error %v", errs[0])
+	}
+	if errs[1].Pointer != "/data/1/id" {
+		t.Fatalf("Unexpected error %v", errs[1])
+	}
+}
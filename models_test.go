@@ -1,7 +1,12 @@
 package jsonapi
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math/big"
+	"net/netip"
+	"strconv"
 	"time"
 )
 
@@ -53,7 +58,6 @@ type Car struct {
 }
 
 type Post struct {
-	Blog
 	ID            uint64     `jsonapi:"primary,posts"`
 	BlogID        int        `jsonapi:"attr,blog_id"`
 	ClientID      string     `jsonapi:"client-id"`
@@ -65,6 +69,15 @@ type Post struct {
 	Links Links `jsonapi:"links,omitempty"`
 }
 
+// BlogPost is a post embedding its blog without a tag, whose fields are
+// promoted.
+type BlogPost struct {
+	Blog
+	ID    uint64 `jsonapi:"primary,posts"`
+	Title string `jsonapi:"attr,title"`
+	Body  string `jsonapi:"attr,body"`
+}
+
 type Comment struct {
 	ID       int    `jsonapi:"primary,comments"`
 	ClientID string `jsonapi:"client-id"`
@@ -219,6 +232,17 @@ type Employee struct {
 	HiredAt   *time.Time `jsonapi:"attr,hired-at,iso8601"`
 }
 
+type Numbers struct {
+	ID      int64       `jsonapi:"primary,numbers"`
+	Int8    int8        `jsonapi:"attr,int8"`
+	Int64   int64       `jsonapi:"attr,int64"`
+	Uint8   *uint8      `jsonapi:"attr,uint8"`
+	Uint64  uint64      `jsonapi:"attr,uint64"`
+	Float32 float32     `jsonapi:"attr,float32"`
+	Number  json.Number `jsonapi:"attr,number"`
+	Any     interface{} `jsonapi:"attr,any"`
+}
+
 type CustomIntType int
 type CustomFloatType float64
 type CustomStringType string
@@ -256,3 +280,215 @@ type BlogPostWithPoly struct {
 	Hero  *OneOfMedia   `jsonapi:"polyrelation,hero-media,omitempty"`
 	Media []*OneOfMedia `jsonapi:"polyrelation,media,omitempty"`
 }
+
+type Color int
+
+const (
+	Red Color = iota + 1
+	Green
+)
+
+func (c Color) MarshalText() ([]byte, error) {
+	switch c {
+	case Red:
+		return []byte("red"), nil
+	case Green:
+		return []byte("green"), nil
+	}
+	return nil, fmt.Errorf("unknown color %d", int(c))
+}
+
+func (c *Color) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "red":
+		*c = Red
+	case "green":
+		*c = Green
+	default:
+		return fmt.Errorf("unknown color %q", text)
+	}
+	return nil
+}
+
+// Money marshals itself as a string of its amount in cents, with methods
+// declared on a pointer receiver only.
+type Money struct {
+	Cents int64
+}
+
+func (m *Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatInt(m.Cents, 10))
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.New("money must be a string")
+	}
+	cents, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	m.Cents = cents
+	return nil
+}
+
+type Gadget struct {
+	ID            string              `jsonapi:"primary,gadgets"`
+	Color         Color               `jsonapi:"attr,color"`
+	ColorPtr      *Color              `jsonapi:"attr,color-ptr,omitempty"`
+	Price         Money               `jsonapi:"attr,price"`
+	Addr          netip.Addr          `jsonapi:"attr,addr"`
+	NullableColor NullableAttr[Color] `jsonapi:"attr,nullable-color,omitempty"`
+}
+
+type Account struct {
+	ID       string                      `jsonapi:"primary,accounts"`
+	Balance  *big.Int                    `jsonapi:"attr,balance,omitempty"`
+	Limit    NullableAttr[*big.Int]      `jsonapi:"attr,limit,omitempty"`
+	Timeout  time.Duration               `jsonapi:"attr,timeout"`
+	Timeouts NullableAttr[time.Duration] `jsonapi:"attr,timeouts,omitempty"`
+}
+
+type Collections struct {
+	ID       string               `jsonapi:"primary,collections"`
+	Ints     []int                `jsonapi:"attr,ints,omitempty"`
+	Floats   []float64            `jsonapi:"attr,floats,omitempty"`
+	Bools    []bool               `jsonapi:"attr,bools,omitempty"`
+	IntPtrs  []*int               `jsonapi:"attr,int-ptrs,omitempty"`
+	Triple   [3]uint8             `jsonapi:"attr,triple"`
+	Bytes    []byte               `jsonapi:"attr,bytes,omitempty"`
+	Counts   map[string]int       `jsonapi:"attr,counts,omitempty"`
+	Tags     map[string][]string  `jsonapi:"attr,tags,omitempty"`
+	ByYear   map[int]string       `jsonapi:"attr,by-year,omitempty"`
+	Bosses   map[string]*Employee `jsonapi:"attr,bosses,omitempty"`
+	Dates    []time.Time          `jsonapi:"attr,dates,iso8601,omitempty"`
+	Colors   []Color              `jsonapi:"attr,colors,omitempty"`
+	Grid     [][]int              `jsonapi:"attr,grid,omitempty"`
+	Anything []interface{}        `jsonapi:"attr,anything,omitempty"`
+}
+
+type Timestamps struct {
+	CreatedAt time.Time  `jsonapi:"attr,created_at,iso8601"`
+	UpdatedAt *time.Time `jsonapi:"attr,updated_at,iso8601,omitempty"`
+}
+
+type BaseModel struct {
+	ID string `jsonapi:"primary,widgets"`
+	Timestamps
+	Links Links `jsonapi:"links,omitempty"`
+}
+
+type Widget struct {
+	BaseModel
+	Name  string   `jsonapi:"attr,name"`
+	Owner *Comment `jsonapi:"relation,owner,omitempty"`
+}
+
+// Gizmo shadows the primary and created_at fields of the BaseModel it embeds
+type Gizmo struct {
+	*BaseModel
+	ID        string `jsonapi:"primary,gizmos"`
+	CreatedAt string `jsonapi:"attr,created_at"`
+}
+
+type Heading struct {
+	Label string `jsonapi:"attr,label"`
+}
+
+type Caption struct {
+	Label string `jsonapi:"attr,label"`
+	Lang  string `jsonapi:"attr,lang"`
+}
+
+// Banner embeds two structs defining the label attribute at the same depth,
+// so neither of them is promoted
+type Banner struct {
+	ID string `jsonapi:"primary,banners"`
+	Heading
+	Caption
+}
+
+// Author and Novel reference each other, forming cycles once included
+type Author struct {
+	ID     string   `jsonapi:"primary,authors"`
+	Name   string   `jsonapi:"attr,name"`
+	Novels []*Novel `jsonapi:"relation,novels"`
+}
+
+type Novel struct {
+	ID     string  `jsonapi:"primary,novels"`
+	Title  string  `jsonapi:"attr,title"`
+	Author *Author `jsonapi:"relation,author"`
+	Sequel *Novel  `jsonapi:"relation,sequel,omitempty"`
+}
+
+type Library struct {
+	ID       string         `jsonapi:"primary,libraries"`
+	Name     string         `jsonapi:"attr,name"`
+	Curator  ToOne[Author]  `jsonapi:"relation,curator"`
+	Novels   ToMany[Novel]  `jsonapi:"relation,novels"`
+	Founder  ToOne[Author]  `jsonapi:"relation,founder,omitempty"`
+	Branches ToMany[Author] `jsonapi:"relation,branches,omitempty"`
+}
+
+type Article struct {
+	ID          string                `jsonapi:"primary,articles"`
+	Title       string                `jsonapi:"attr,title"`
+	TotalViews  int64                 `jsonapi:"meta,total_views"`
+	PublishedAt time.Time             `jsonapi:"meta,published_at,iso8601"`
+	Rating      NullableAttr[float64] `jsonapi:"meta,rating,omitempty"`
+	Color       Color                 `jsonapi:"meta,color,omitempty"`
+}
+
+func (a *Article) JSONAPIMeta() *Meta {
+	return &Meta{"source": "metable"}
+}
+
+type ArticleStats struct {
+	Views  int    `json:"views"`
+	Source string `json:"source,omitempty"`
+}
+
+type ArticleWithStats struct {
+	ID    string        `jsonapi:"primary,articles"`
+	Stats *ArticleStats `jsonapi:"meta"`
+}
+
+type ArticleWithMeta struct {
+	ID   string `jsonapi:"primary,articles"`
+	Meta Meta   `jsonapi:"meta"`
+}
+
+type Preferences struct {
+	Theme    string   `jsonapi:"attr,theme"`
+	Notify   bool     `jsonapi:"attr,notify"`
+	Channels []string `jsonapi:"attr,channels"`
+}
+
+type Profile struct {
+	ID          string               `jsonapi:"primary,profiles"`
+	Name        string               `jsonapi:"attr,name"`
+	Bio         NullableAttr[string] `jsonapi:"attr,bio"`
+	Age         int                  `jsonapi:"attr,age"`
+	Preferences Preferences          `jsonapi:"attr,preferences,merge"`
+	Boss        *Employee            `jsonapi:"attr,boss,merge"`
+	Manager     *Employee            `jsonapi:"attr,manager"`
+	Avatar      *Image               `jsonapi:"relation,avatar"`
+	Posts       []*Post              `jsonapi:"relation,posts"`
+	Curator     ToOne[Author]        `jsonapi:"relation,curator"`
+}
+
+type Device struct {
+	ID       int                `jsonapi:"primary,devices"`
+	Battery  int                `jsonapi:"attr,battery"`
+	Level    *float64           `jsonapi:"attr,level"`
+	Charging bool               `jsonapi:"attr,charging"`
+	Model    string             `jsonapi:"attr,model"`
+	Rooted   string             `jsonapi:"attr,rooted"`
+	Owner    string             `jsonapi:"attr,owner"`
+	Tags     []string           `jsonapi:"attr,tags"`
+	Ports    []int              `jsonapi:"attr,ports"`
+	Enabled  NullableAttr[bool] `jsonapi:"attr,enabled"`
+	Author   *Author            `jsonapi:"relation,author"`
+}
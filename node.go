@@ -10,10 +10,11 @@ type Payloader interface {
 // OnePayload is used to represent a generic JSON API payload where a single
 // resource (Node) was included as an {} in the "data" key
 type OnePayload struct {
-	Data     *Node   `json:"data"`
-	Included []*Node `json:"included,omitempty"`
-	Links    *Links  `json:"links,omitempty"`
-	Meta     *Meta   `json:"meta,omitempty"`
+	Data     *Node          `json:"data"`
+	Included []*Node        `json:"included,omitempty"`
+	Links    *Links         `json:"links,omitempty"`
+	Meta     *Meta          `json:"meta,omitempty"`
+	JSONAPI  *JSONAPIObject `json:"jsonapi,omitempty"`
 }
 
 func (p *OnePayload) clearIncluded() {
@@ -23,16 +24,27 @@ func (p *OnePayload) clearIncluded() {
 // ManyPayload is used to represent a generic JSON API payload where many
 // resources (Nodes) were included in an [] in the "data" key
 type ManyPayload struct {
-	Data     []*Node `json:"data"`
-	Included []*Node `json:"included,omitempty"`
-	Links    *Links  `json:"links,omitempty"`
-	Meta     *Meta   `json:"meta,omitempty"`
+	Data     []*Node        `json:"data"`
+	Included []*Node        `json:"included,omitempty"`
+	Links    *Links         `json:"links,omitempty"`
+	Meta     *Meta          `json:"meta,omitempty"`
+	JSONAPI  *JSONAPIObject `json:"jsonapi,omitempty"`
 }
 
 func (p *ManyPayload) clearIncluded() {
 	p.Included = []*Node{}
 }
 
+// JSONAPIObject is used to represent the top-level `jsonapi` object, which
+// describes the server's implementation.
+// http://jsonapi.org/format/#document-jsonapi-object
+type JSONAPIObject struct {
+	Version string   `json:"version,omitempty"`
+	Ext     []string `json:"ext,omitempty"`
+	Profile []string `json:"profile,omitempty"`
+	Meta    *Meta    `json:"meta,omitempty"`
+}
+
 // Node is used to represent a generic JSON API Resource
 type Node struct {
 	Type          string                 `json:"type"`
@@ -59,6 +71,13 @@ type RelationshipManyNode struct {
 	Meta  *Meta   `json:"meta,omitempty"`
 }
 
+// RelationshipLinksNode is used to represent a JSON API relation written
+// without resource linkage, with its links and meta only
+type RelationshipLinksNode struct {
+	Links *Links `json:"links,omitempty"`
+	Meta  *Meta  `json:"meta,omitempty"`
+}
+
 // Links is used to represent a `links` object.
 // http://jsonapi.org/format/#document-links
 type Links map[string]interface{}
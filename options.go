@@ -0,0 +1,276 @@
+package jsonapi
+
+// UnmarshalOption configures how UnmarshalPayload and UnmarshalManyPayload
+// decode a document.
+type UnmarshalOption func(*unmarshalOptions)
+
+type unmarshalOptions struct {
+	collectErrors          bool
+	disallowUnknownMembers bool
+	codecs                 *codecRegistry
+	includedPolicy         IncludedPolicy
+	limits                 Limits
+	report                 *UnmarshalReport
+	lenient                bool
+	coercionHook           func(Coercion)
+	// patch is set by UnmarshalPatch.
+	patch bool
+}
+
+func newUnmarshalOptions(opts []UnmarshalOption) *unmarshalOptions {
+	o := new(unmarshalOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// CollectErrors makes unmarshaling carry on past members that cannot be
+// unmarshaled, instead of stopping at the first one. Every such member of the
+// document, including members of nested attribute structs and of included
+// resources, is then reported in a single UnmarshalErrors error.
+func CollectErrors() UnmarshalOption {
+	return func(o *unmarshalOptions) {
+		o.collectErrors = true
+	}
+}
+
+// DisallowUnknownMembers makes unmarshaling fail on members of the document
+// the model does not define, much like `json.Decoder.DisallowUnknownFields`.
+// These are attributes and relationships with no matching struct field,
+// top-level members not defined by the JSON API spec, included resources
+// whose type cannot be reached from the model through its relationships, and
+// polyrelation resources whose type has no matching choice field. Each is
+// reported as an *UnmarshalError wrapping ErrUnknownMember or ErrUnknownType.
+func DisallowUnknownMembers() UnmarshalOption {
+	return func(o *unmarshalOptions) {
+		o.disallowUnknownMembers = true
+	}
+}
+
+// StreamIncluded sets how UnmarshalManyStream handles an "included" array
+// that comes after the "data" array of the document. It has no effect on the
+// other unmarshal functions, which read the whole document first.
+func StreamIncluded(policy IncludedPolicy) UnmarshalOption {
+	return func(o *unmarshalOptions) {
+		o.includedPolicy = policy
+	}
+}
+
+// UnmarshalLimits rejects documents exceeding limits with a *LimitError. The
+// document is checked as it is read, so that it is rejected as soon as it
+// exceeds a limit: neither buffered nor decoded past that point, and before
+// any of its resources is unmarshaled. Limits are enforced even with the
+// CollectErrors option.
+func UnmarshalLimits(limits Limits) UnmarshalOption {
+	return func(o *unmarshalOptions) {
+		o.limits = limits
+	}
+}
+
+// MarshalOption configures how MarshalPayload and the other marshal functions
+// encode a document.
+type MarshalOption func(*marshalOptions)
+
+type marshalOptions struct {
+	codecs        *codecRegistry
+	limits        Limits
+	includedOrder IncludedOrder
+	canonical     bool
+	// fieldsets maps resource types to the set of the names of the
+	// attributes and relationships to write for them.
+	fieldsets map[string]map[string]struct{}
+	// include is the tree of the include paths, nil when every relationship
+	// is sideloaded.
+	include      includeTree
+	includePaths []string
+	offPath      OffPathRelationships
+	// links, meta and jsonapi are the top-level members of the document.
+	links   *Links
+	meta    *Meta
+	jsonapi *JSONAPIObject
+}
+
+func newMarshalOptions(opts []MarshalOption) *marshalOptions {
+	o := new(marshalOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// MarshalLimits makes marshaling fail with a *LimitError, rather than write a
+// document exceeding limits. MaxDepth and MaxAttributeBytes apply to the
+// JSON encoding of the document, and are checked as it is written: Marshal,
+// which does not encode the document, only checks the number of resources.
+func MarshalLimits(limits Limits) MarshalOption {
+	return func(o *marshalOptions) {
+		o.limits = limits
+	}
+}
+
+// IncludedOrder is the order of the resources of the "included" array of the
+// documents written by the marshal functions.
+type IncludedOrder int
+
+const (
+	// IncludedReferenceOrder writes the included resources in the order they
+	// are first referenced, breadth first: the resources related to the
+	// primary data come first, in the order of the primary data, then those
+	// related to these in turn, and so on. The relationships of a resource
+	// are walked by name. This is the default.
+	IncludedReferenceOrder IncludedOrder = iota
+	// IncludedSorted writes the included resources sorted by type, then by
+	// ID. IDs that are both integers are compared numerically.
+	IncludedSorted
+)
+
+// OrderIncluded sets the order of the resources of the "included" array.
+// Either order is stable: marshaling the same models always writes the
+// included resources in the same order.
+func OrderIncluded(order IncludedOrder) MarshalOption {
+	return func(o *marshalOptions) {
+		o.includedOrder = order
+	}
+}
+
+// Canonical makes MarshalPayload and the other marshal functions writing to
+// an io.Writer write a canonical encoding of the document, byte-identical for
+// equal models: the included resources are sorted, as with IncludedSorted,
+// and HTML characters are not escaped. The members of objects are always
+// written in a fixed order, map keys being sorted as with encoding/json.
+func Canonical() MarshalOption {
+	return func(o *marshalOptions) {
+		o.includedOrder = IncludedSorted
+		o.canonical = true
+	}
+}
+
+// SparseFieldsets restricts the attributes and relationships written for the
+// resources of each type of fieldsets, primary and included alike, to the
+// listed names, as requested with the `fields[TYPE]` query parameters of the
+// JSON API spec. The relationships left out are not written at all, and the
+// resources they link to are not sideloaded through them. The type and id of
+// a resource are always written, and so are its links and meta. Resources of
+// the types missing from fieldsets are written whole.
+//
+// ParseSparseFieldsets reads fieldsets from the query of a request.
+func SparseFieldsets(fieldsets map[string][]string) MarshalOption {
+	return func(o *marshalOptions) {
+		o.fieldsets = make(map[string]map[string]struct{}, len(fieldsets))
+		for typ, names := range fieldsets {
+			set := make(map[string]struct{}, len(names))
+			for _, name := range names {
+				set[name] = struct{}{}
+			}
+			o.fieldsets[typ] = set
+		}
+	}
+}
+
+// allowsField reports whether field, of a model with the given plan, is
+// written under the sparse fieldsets.
+func (o *marshalOptions) allowsField(plan *typePlan, field *fieldPlan) bool {
+	if o.fieldsets == nil || plan.primary == nil {
+		return true
+	}
+
+	switch field.annotation {
+	case annotationAttribute, annotationRelation, annotationPolyRelation:
+	default:
+		return true
+	}
+
+	set, ok := o.fieldsets[plan.primary.name]
+	if !ok {
+		return true
+	}
+	_, ok = set[field.name]
+	return ok
+}
+
+// TopLevelLinks sets the top-level links of the document, whether its primary
+// data is one resource, many or errors. They are added to the links of a
+// collection implementing Linkable, taking precedence over them. The links of
+// a single resource implementing Linkable are still written on the resource.
+func TopLevelLinks(links *Links) MarshalOption {
+	return func(o *marshalOptions) {
+		o.links = links
+	}
+}
+
+// TopLevelMeta sets the top-level meta of the document, whether its primary
+// data is one resource, many or errors. Its members are added to those of a
+// collection implementing Metable, taking precedence over them. The meta of a
+// single resource implementing Metable is still written on the resource.
+func TopLevelMeta(meta *Meta) MarshalOption {
+	return func(o *marshalOptions) {
+		o.meta = meta
+	}
+}
+
+// TopLevelJSONAPI sets the top-level `jsonapi` object of the document,
+// describing the implementation of the server, e.g.
+// `&jsonapi.JSONAPIObject{Version: "1.1"}`.
+func TopLevelJSONAPI(jsonapi *JSONAPIObject) MarshalOption {
+	return func(o *marshalOptions) {
+		o.jsonapi = jsonapi
+	}
+}
+
+// topLevel sets the top-level links, meta and jsonapi object of a document,
+// given those the models provide, if any, to those set with the TopLevel
+// options.
+func (o *marshalOptions) topLevel(links **Links, meta **Meta, jsonapi **JSONAPIObject) error {
+	if o.links != nil {
+		if err := o.links.validate(); err != nil {
+			return err
+		}
+		*links = mergeLinks(*links, o.links)
+	}
+	*meta = mergeMeta(*meta, o.meta)
+	if o.jsonapi != nil {
+		*jsonapi = o.jsonapi
+	}
+	return nil
+}
+
+// mergeLinks returns the members of a and b, those of b taking precedence,
+// without modifying either.
+func mergeLinks(a, b *Links) *Links {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+
+	merged := make(Links, len(*a)+len(*b))
+	for k, v := range *a {
+		merged[k] = v
+	}
+	for k, v := range *b {
+		merged[k] = v
+	}
+	return &merged
+}
+
+// mergeMeta returns the members of a and b, those of b taking precedence,
+// without modifying either.
+func mergeMeta(a, b *Meta) *Meta {
+	if a == nil || b == nil {
+		if a == nil {
+			return b
+		}
+		return a
+	}
+
+	merged := make(Meta, len(*a)+len(*b))
+	for k, v := range *a {
+		merged[k] = v
+	}
+	for k, v := range *b {
+		merged[k] = v
+	}
+	return &merged
+}
@@ -0,0 +1,219 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// ErrResourceMismatch is returned by UnmarshalPatch when the type or id of the
+// resource of the document does not match those of the model it is applied
+// to.
+var ErrResourceMismatch = errors.New("resource does not match the model")
+
+// UnmarshalPatch applies the resource of a PATCH request document read from
+// in onto model, a pointer to a struct that already holds the current state of
+// the resource, e.g. as loaded from a database:
+//
+//	blog, err := loadBlog(id)
+//	if err != nil {
+//		// ...
+//	}
+//	if err := jsonapi.UnmarshalPatch(r.Body, blog); err != nil {
+//		// ...
+//	}
+//
+// Only the members sent in the document change the model:
+//
+//   - Attributes and relationships absent from the document are left as is.
+//   - An attribute set to null clears its field to the zero value, or to an
+//     explicit null for a NullableAttr. So does a to-one relationship whose
+//     data is null.
+//   - A nested attribute struct is replaced by the object sent, unless its
+//     field is tagged with the `merge` option, e.g.
+//     `jsonapi:"attr,settings,merge"`, in which case the members of the
+//     object are applied onto the struct the model holds with these same
+//     rules.
+//   - A relationship is replaced by the linkage sent, as the JSON API spec
+//     requires. Related models the model already holds are kept, as they are,
+//     for the resources that are still linked.
+//
+// The type and id of the resource must match those of model; an
+// *UnmarshalError wrapping ErrResourceMismatch is returned otherwise, whose
+// ErrorObject has a 409 Conflict status.
+func UnmarshalPatch(in io.Reader, model interface{}, opts ...UnmarshalOption) error {
+	if v := reflect.ValueOf(model); v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return ErrUnexpectedType
+	}
+
+	o := newUnmarshalOptions(opts)
+	o.patch = true
+
+	_, err := unmarshalOnePayload(in, model, o)
+	return err
+}
+
+// checkPatchTarget checks that the resource n matches the type and id of
+// model, the target of UnmarshalPatch.
+func checkPatchTarget(n *Node, model reflect.Value) error {
+	plan := typePlanFor(model.Elem().Type())
+	if plan.primary == nil {
+		return ErrTypeNotFound
+	}
+
+	if n == nil {
+		return &UnmarshalError{
+			Pointer: "/data",
+			Type:    model.Type(),
+			Err:     fmt.Errorf("%w: data is null", ErrResourceMismatch),
+		}
+	}
+
+	if n.Type != plan.primary.name {
+		return &UnmarshalError{
+			Pointer: "/data/type",
+			Type:    model.Type(),
+			Err:     fmt.Errorf("%w: type %q, expected %q", ErrResourceMismatch, n.Type, plan.primary.name),
+		}
+	}
+
+	id := ""
+	if v, ok := fieldByIndex(model.Elem(), plan.primary.index); ok {
+		if v = reflect.Indirect(v); v.IsValid() {
+			id = fmt.Sprint(v.Interface())
+		}
+	}
+	if n.ID != id {
+		return &UnmarshalError{
+			Pointer: "/data/id",
+			Field:   plan.primary.structField.Name,
+			Type:    model.Type(),
+			Err:     fmt.Errorf("%w: id %q, expected %q", ErrResourceMismatch, n.ID, id),
+		}
+	}
+
+	return nil
+}
+
+// rememberRelated records the related models held by the relationship fields
+// of model in the identity map, so that the relationships of the document
+// still linking to them resolve to these instances.
+func (s *unmarshalState) rememberRelated(model reflect.Value) {
+	modelValue := model.Elem()
+
+	for _, field := range typePlanFor(modelValue.Type()).fields {
+		if field.annotation != annotationRelation && field.annotation != annotationPolyRelation {
+			continue
+		}
+
+		fieldValue, ok := fieldByIndex(modelValue, field.index)
+		if !ok {
+			continue
+		}
+
+		if field.isToOne || field.isToMany {
+			fieldValue = fieldValue.FieldByName("Data")
+		} else if field.isNullableRelationship {
+			fieldValue = fieldValue.MapIndex(reflect.ValueOf(true))
+		}
+
+		var related []reflect.Value
+		if fieldValue.IsValid() && fieldValue.Kind() == reflect.Slice {
+			for i := 0; i < fieldValue.Len(); i++ {
+				related = append(related, fieldValue.Index(i))
+			}
+		} else if fieldValue.IsValid() {
+			related = append(related, fieldValue)
+		}
+
+		for _, r := range related {
+			if field.annotation == annotationPolyRelation {
+				r = reflect.Indirect(r)
+				if !r.IsValid() {
+					continue
+				}
+				// Only the chosen field of a choice struct holds a model
+				for i := 0; i < r.NumField(); i++ {
+					s.rememberModel(r.Field(i))
+				}
+				continue
+			}
+			s.rememberModel(r)
+		}
+	}
+}
+
+// rememberModel records model, a pointer to a struct with a primary
+// annotation, in the identity map.
+func (s *unmarshalState) rememberModel(model reflect.Value) {
+	if model.Kind() != reflect.Ptr || model.IsNil() || model.Elem().Kind() != reflect.Struct {
+		return
+	}
+
+	plan := typePlanFor(model.Elem().Type())
+	if plan.primary == nil {
+		return
+	}
+
+	id, ok := fieldByIndex(model.Elem(), plan.primary.index)
+	if !ok {
+		return
+	}
+	if id = reflect.Indirect(id); !id.IsValid() {
+		return
+	}
+
+	// model may be a field of the model being patched, which is about to be
+	// overwritten: remember the pointer it holds rather than the field
+	s.remember(&Node{Type: plan.primary.name, ID: fmt.Sprint(id.Interface())}, reflect.ValueOf(model.Interface()))
+}
+
+// clearValue clears fieldValue, the value of field, in response to an explicit
+// null in a PATCH request document.
+func clearValue(field *fieldPlan, fieldValue reflect.Value) {
+	if field.isNullableAttr {
+		fieldValue.Set(reflect.MakeMapWithSize(fieldValue.Type(), 1))
+		fieldValue.SetMapIndex(reflect.ValueOf(false), reflect.Zero(fieldValue.Type().Elem()))
+		return
+	}
+	fieldValue.Set(reflect.Zero(fieldValue.Type()))
+}
+
+// mergeStruct applies attribute, the object of a nested attribute struct, onto
+// the struct fieldValue already holds, rather than onto a new one. It returns
+// false when there is nothing to merge into, and the attribute should be
+// unmarshaled as usual.
+func mergeStruct(attribute interface{}, fieldValue reflect.Value, state *unmarshalState, loc location) (reflect.Value, bool, error) {
+	if _, ok := attribute.(map[string]interface{}); !ok {
+		return reflect.Value{}, false, nil
+	}
+
+	var model reflect.Value
+	switch {
+	case fieldValue.Kind() == reflect.Ptr && !fieldValue.IsNil():
+		model = fieldValue
+	case fieldValue.Kind() == reflect.Struct && fieldValue.CanAddr():
+		model = fieldValue.Addr()
+	default:
+		return reflect.Value{}, false, nil
+	}
+
+	data, err := json.Marshal(attribute)
+	if err != nil {
+		return reflect.Value{}, true, err
+	}
+
+	node := new(Node)
+	if err := decodeJSON(bytes.NewReader(data), &node.Attributes); err != nil {
+		return reflect.Value{}, true, err
+	}
+
+	if err := unmarshalNode(node, model, state, loc); err != nil {
+		return reflect.Value{}, true, err
+	}
+
+	return model, true, nil
+}
@@ -0,0 +1,155 @@
+package jsonapi
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testProfile() *Profile {
+	return &Profile{
+		ID:          "1",
+		Name:        "Jane",
+		Bio:         NewNullableAttrWithValue("Hello"),
+		Age:         42,
+		Preferences: Preferences{Theme: "dark", Notify: true, Channels: []string{"email"}},
+		Boss:        &Employee{Firstname: "Ada", Surname: "Lovelace", Age: 36},
+		Manager:     &Employee{Firstname: "Grace", Surname: "Hopper"},
+		Avatar:      &Image{ID: "1", Src: "jane.png"},
+		Posts:       []*Post{{ID: 1, Title: "Foo"}, {ID: 2, Title: "Bar"}},
+		Curator:     ToOne[Author]{Linkage: &ResourceIdentifier{Type: "authors", ID: "1"}, Data: &Author{ID: "1", Name: "Frank"}},
+	}
+}
+
+func TestUnmarshalPatch(t *testing.T) {
+	profile := testProfile()
+	posts := profile.Posts
+
+	in := `{
+		"data": {
+			"type": "profiles",
+			"id": "1",
+			"attributes": {
+				"name": "Janet",
+				"bio": null,
+				"age": null,
+				"preferences": {"theme": "light", "channels": null},
+				"boss": {"surname": "Byron"},
+				"manager": {"firstname": "Alan"}
+			},
+			"relationships": {
+				"avatar": {"data": null},
+				"posts": {"data": [{"type": "posts", "id": "2"}, {"type": "posts", "id": "3"}]}
+			}
+		}
+	}`
+
+	if err := UnmarshalPatch(strings.NewReader(in), profile); err != nil {
+		t.Fatal(err)
+	}
+
+	if profile.Name != "Janet" || profile.Age != 0 {
+		t.Fatalf("Unexpected name %q and age %d", profile.Name, profile.Age)
+	}
+	if !profile.Bio.IsNull() {
+		t.Fatalf("Expected an explicit null bio, got %v", profile.Bio)
+	}
+
+	// merged
+	expectedPreferences := Preferences{Theme: "light", Notify: true}
+	if !reflect.DeepEqual(profile.Preferences, expectedPreferences) {
+		t.Fatalf("Expected preferences %+v, got %+v", expectedPreferences, profile.Preferences)
+	}
+	if e, a := (Employee{Firstname: "Ada", Surname: "Byron", Age: 36}), *profile.Boss; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected boss %+v, got %+v", e, a)
+	}
+
+	// replaced
+	if e, a := (Employee{Firstname: "Alan"}), *profile.Manager; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected manager %+v, got %+v", e, a)
+	}
+
+	if profile.Avatar != nil {
+		t.Fatalf("Expected the avatar to be cleared, got %+v", profile.Avatar)
+	}
+	if len(profile.Posts) != 2 || profile.Posts[0] != posts[1] || profile.Posts[1].ID != 3 {
+		t.Fatalf("Expected the posts to be replaced, keeping the loaded post 2, got %+v", profile.Posts)
+	}
+
+	// untouched
+	if profile.Curator.Data == nil || profile.Curator.Data.Name != "Frank" {
+		t.Fatalf("Expected the curator to be left as is, got %+v", profile.Curator)
+	}
+}
+
+func TestUnmarshalPatch_relationshipValues(t *testing.T) {
+	profile := testProfile()
+	curator := profile.Curator.Data
+
+	in := `{"data": {"type": "profiles", "id": "1", "relationships": {"curator": {"data": {"type": "authors", "id": "1"}}}}}`
+	if err := UnmarshalPatch(strings.NewReader(in), profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Curator.Data != curator {
+		t.Fatalf("Expected the loaded curator to be kept, got %+v", profile.Curator)
+	}
+
+	in = `{"data": {"type": "profiles", "id": "1", "relationships": {"curator": {"data": null}}}}`
+	if err := UnmarshalPatch(strings.NewReader(in), profile); err != nil {
+		t.Fatal(err)
+	}
+	if profile.Curator.Linkage != nil || profile.Curator.Data != nil {
+		t.Fatalf("Expected the curator to be cleared, got %+v", profile.Curator)
+	}
+}
+
+func TestUnmarshalPatch_mismatch(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		in      string
+		pointer string
+	}{
+		{"type", `{"data": {"type": "people", "id": "1", "attributes": {"name": "Janet"}}}`, "/data/type"},
+		{"id", `{"data": {"type": "profiles", "id": "2", "attributes": {"name": "Janet"}}}`, "/data/id"},
+		{"missing id", `{"data": {"type": "profiles", "attributes": {"name": "Janet"}}}`, "/data/id"},
+		{"null data", `{"data": null}`, "/data"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			profile := testProfile()
+			err := UnmarshalPatch(strings.NewReader(tc.in), profile)
+			if !errors.Is(err, ErrResourceMismatch) {
+				t.Fatalf("Expected ErrResourceMismatch, got %v", err)
+			}
+
+			var ue *UnmarshalError
+			if !errors.As(err, &ue) || ue.Pointer != tc.pointer {
+				t.Fatalf("Expected an *UnmarshalError at %s, got %v", tc.pointer, err)
+			}
+			if status := ue.ErrorObject().Status; status != "409" {
+				t.Fatalf("Expected a 409 status, got %s", status)
+			}
+			if profile.Name != "Jane" {
+				t.Fatalf("Expected the model to be left as is, got %+v", profile)
+			}
+		})
+	}
+}
+
+func TestUnmarshalPatch_numericID(t *testing.T) {
+	post := &Post{ID: 5, Title: "Foo", Body: "Bar"}
+
+	in := `{"data": {"type": "posts", "id": "5", "attributes": {"title": "Baz"}}}`
+	if err := UnmarshalPatch(strings.NewReader(in), post); err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Baz" || post.Body != "Bar" {
+		t.Fatalf("Unexpected post %+v", post)
+	}
+}
+
+func TestUnmarshalPatch_unexpectedType(t *testing.T) {
+	if err := UnmarshalPatch(strings.NewReader(`{}`), Profile{}); err != ErrUnexpectedType {
+		t.Fatalf("Expected ErrUnexpectedType, got %v", err)
+	}
+}
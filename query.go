@@ -0,0 +1,53 @@
+package jsonapi
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ParseSparseFieldsets returns the sparse fieldsets requested with the
+// `fields[TYPE]` parameters of query, e.g. `fields[posts]=title,body`, mapping
+// each type to the names of its attributes and relationships. An empty
+// parameter, e.g. `fields[posts]=`, maps its type to an empty list. The result
+// is meant for the SparseFieldsets option.
+func ParseSparseFieldsets(query url.Values) map[string][]string {
+	fieldsets := map[string][]string{}
+	for key, values := range query {
+		if !strings.HasPrefix(key, "fields[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		typ := key[len("fields[") : len(key)-1]
+
+		names := []string{}
+		for _, value := range values {
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		fieldsets[typ] = names
+	}
+	return fieldsets
+}
+
+// ParseInclude returns the relationship paths requested with the `include`
+// parameter of query, e.g. `include=comments.author,tags`, and whether the
+// parameter is present at all: an empty parameter, e.g. `include=`, requests
+// no related resource. The result is meant for the Include option.
+func ParseInclude(query url.Values) ([]string, bool) {
+	values, ok := query["include"]
+	if !ok {
+		return nil, false
+	}
+
+	paths := []string{}
+	for _, value := range values {
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" {
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths, true
+}
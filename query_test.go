@@ -0,0 +1,42 @@
+package jsonapi
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseSparseFieldsets(t *testing.T) {
+	query, err := url.ParseQuery("fields[posts]=title,%20body&fields[comments]=&fields[blogs]=title&fields[blogs]=posts&include=posts&page[size]=10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"posts":    {"title", "body"},
+		"comments": {},
+		"blogs":    {"title", "posts"},
+	}
+	if fieldsets := ParseSparseFieldsets(query); !reflect.DeepEqual(fieldsets, expected) {
+		t.Fatalf("Expected fieldsets %v, got %v", expected, fieldsets)
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	query, err := url.ParseQuery("include=comments.author,%20tags&include=&fields[posts]=title")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, ok := ParseInclude(query)
+	if !ok {
+		t.Fatal("Expected the include parameter to be found")
+	}
+	if e := []string{"comments.author", "tags"}; !reflect.DeepEqual(paths, e) {
+		t.Fatalf("Expected paths %v, got %v", e, paths)
+	}
+
+	if paths, ok := ParseInclude(url.Values{}); ok || paths != nil {
+		t.Fatalf("Expected no include parameter, got %v", paths)
+	}
+}
@@ -0,0 +1,308 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// ResourceIdentifier identifies a resource by its type and id, as found in the
+// linkage of a relationship.
+// http://jsonapi.org/format/#document-resource-identifier-objects
+type ResourceIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// ToOne is a to-one relationship to a model of type T, a struct type with
+// jsonapi annotations, which also carries the linkage, links and meta of the
+// relationship object:
+//
+//	type Post struct {
+//		ID     int            `jsonapi:"primary,posts"`
+//		Author ToOne[Person]  `jsonapi:"relation,author"`
+//	}
+//
+// When unmarshaling, Linkage identifies the related resource and Data is only
+// set when the document holds the related resource itself, i.e. when it is
+// loaded. When marshaling, the linkage is taken from Linkage, or from Data if
+// Linkage is nil, and the models of Data that the linkage identifies are
+// sideloaded into the "included" array. Links and Meta take precedence over
+// those returned by RelationshipLinkable and RelationshipMetable.
+//
+// ToOne is only supported with the `relation` annotation.
+type ToOne[T any] struct {
+	// Linkage identifies the related resource. It is nil for an empty
+	// relationship, or when the relationship object has no data member.
+	Linkage *ResourceIdentifier
+	// Data is the related model, if loaded.
+	Data *T
+	// Links and Meta are the links and meta of the relationship object.
+	Links *Links
+	Meta  *Meta
+}
+
+// Loaded reports whether the related resource is loaded into Data.
+func (r ToOne[T]) Loaded() bool {
+	return r.Data != nil
+}
+
+// ToMany is a to-many relationship to models of type T, a struct type with
+// jsonapi annotations, which also carries the linkage, links and meta of the
+// relationship object. It behaves like ToOne: Data holds the models of the
+// related resources that are loaded, in the order of Linkage.
+//
+// ToMany is only supported with the `relation` annotation.
+type ToMany[T any] struct {
+	// Linkage identifies the related resources. It is nil when the
+	// relationship object has no data member.
+	Linkage []ResourceIdentifier
+	// Data holds the related models that are loaded, in the order of
+	// Linkage but without the unloaded ones: Data[i] is only the model of
+	// Linkage[i] when Loaded reports true.
+	Data []*T
+	// Links and Meta are the links and meta of the relationship object.
+	Links *Links
+	Meta  *Meta
+}
+
+// Loaded reports whether every resource identified by Linkage is loaded into
+// Data. It also reports true for an empty relationship, and for a
+// relationship object without a data member, as neither links to a resource.
+func (r ToMany[T]) Loaded() bool {
+	return len(r.Data) == len(r.Linkage)
+}
+
+// visitRelationshipValue marshals fieldValue, the ToOne or ToMany value of
+// field, into the relationships of node.
+func visitRelationshipValue(model interface{}, field *fieldPlan, node *Node, fieldValue reflect.Value, included *map[string]*Node, sideload bool, state *marshalState) error {
+	linkage := fieldValue.FieldByName("Linkage")
+	data := fieldValue.FieldByName("Data")
+	relLinks := fieldValue.FieldByName("Links").Interface().(*Links)
+	relMeta := fieldValue.FieldByName("Meta").Interface().(*Meta)
+
+	if field.omitEmpty && isEmptyRelationshipValue(linkage) &&
+		isEmptyRelationshipValue(data) && relLinks == nil && relMeta == nil {
+		return nil
+	}
+
+	follow := state.follows(field.name, sideload)
+	if !follow {
+		if state.opts.offPath == OffPathLinksOnly {
+			visitRelationshipLinks(model, field, node, relLinks, relMeta)
+			return nil
+		}
+		// Related resources off the include paths are linked, not sideloaded
+		sideload = false
+	}
+
+	var identifiers []ResourceIdentifier
+	if !linkage.IsNil() {
+		var ok bool
+		if identifiers, ok = linkage.Interface().([]ResourceIdentifier); !ok {
+			identifiers = []ResourceIdentifier{*linkage.Interface().(*ResourceIdentifier)}
+		}
+	}
+
+	var models []reflect.Value
+	if data.Kind() == reflect.Slice {
+		for i := 0; i < data.Len(); i++ {
+			models = append(models, data.Index(i))
+		}
+	} else if !data.IsNil() {
+		models = append(models, data)
+	}
+
+	// Only the models that the linkage identifies are visited and sideloaded,
+	// so that every included resource is linked
+	linkedKeys := make(map[string]bool, len(identifiers))
+	for _, id := range identifiers {
+		linkedKeys[fmt.Sprintf("%s,%s", id.Type, id.ID)] = true
+	}
+
+	nodes := make([]*Node, 0, len(models))
+	for _, m := range models {
+		if m.IsNil() {
+			return ErrUnexpectedNil
+		}
+
+		if !linkage.IsNil() {
+			id, err := visitModelIdentifier(m.Interface())
+			if err != nil {
+				return err
+			}
+			if !linkedKeys[fmt.Sprintf("%s,%s", id.Type, id.ID)] {
+				continue
+			}
+		}
+
+		n, err := visitRelatedModel(m.Interface(), field.name, follow, included, sideload, state)
+		if err != nil {
+			return err
+		}
+		if sideload {
+			appendIncluded(included, n)
+		}
+		nodes = append(nodes, n)
+	}
+
+	related := func(n *Node) *Node {
+		if sideload {
+			return toShallowNode(n)
+		}
+		return n
+	}
+
+	linked := []*Node{}
+	if linkage.IsNil() {
+		for _, n := range nodes {
+			linked = append(linked, related(n))
+		}
+	} else {
+		byKey := make(map[string]*Node, len(nodes))
+		for _, n := range nodes {
+			byKey[fmt.Sprintf("%s,%s", n.Type, n.ID)] = n
+		}
+
+		for _, id := range identifiers {
+			if n := byKey[fmt.Sprintf("%s,%s", id.Type, id.ID)]; n != nil {
+				linked = append(linked, related(n))
+			} else {
+				linked = append(linked, &Node{Type: id.Type, ID: id.ID})
+			}
+		}
+	}
+
+	if relLinks == nil {
+		if linkableModel, ok := model.(RelationshipLinkable); ok {
+			relLinks = linkableModel.JSONAPIRelationshipLinks(field.name)
+		}
+	}
+	if relMeta == nil {
+		if metableModel, ok := model.(RelationshipMetable); ok {
+			relMeta = metableModel.JSONAPIRelationshipMeta(field.name)
+		}
+	}
+
+	if field.isToMany {
+		node.Relationships[field.name] = &RelationshipManyNode{
+			Data:  linked,
+			Links: relLinks,
+			Meta:  relMeta,
+		}
+		return nil
+	}
+
+	relationship := &RelationshipOneNode{Links: relLinks, Meta: relMeta}
+	if len(linked) > 0 {
+		relationship.Data = linked[0]
+	}
+	node.Relationships[field.name] = relationship
+	return nil
+}
+
+// isEmptyRelationshipValue reports whether v, a field of a ToOne or ToMany,
+// holds nothing.
+func isEmptyRelationshipValue(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return v.IsNil()
+}
+
+// unmarshalRelationshipValue unmarshals relationship, the relationship object
+// of field, into fieldValue, a ToOne or ToMany. The related resources that the
+// document holds are unmarshaled into Data.
+func unmarshalRelationshipValue(relationship interface{}, field *fieldPlan, fieldValue reflect.Value, state *unmarshalState, loc location) error {
+	pointer := loc.relationship(field.name)
+
+	buf := bytes.NewBuffer(nil)
+	json.NewEncoder(buf).Encode(relationship) //nolint:errcheck
+
+	var nodes []*Node
+	var relLinks *Links
+	var relMeta *Meta
+	var err error
+	if field.isToMany {
+		many := new(RelationshipManyNode)
+		err = decodeJSON(buf, many)
+		nodes, relLinks, relMeta = many.Data, many.Links, many.Meta
+	} else {
+		one := new(RelationshipOneNode)
+		err = decodeJSON(buf, one)
+		if one.Data != nil {
+			nodes = []*Node{one.Data}
+		}
+		relLinks, relMeta = one.Links, one.Meta
+	}
+	if err != nil {
+		return state.report(newUnmarshalError(pointer, loc.fieldPath(field), field.structField.Type, fmt.Errorf("Could not unmarshal json: %w", err)))
+	}
+	normalizeTopLevel(relLinks, relMeta, nil)
+
+	data := fieldValue.FieldByName("Data")
+	modelType := data.Type().Elem()
+	if field.isToMany {
+		modelType = modelType.Elem()
+	}
+	primary := typePlanFor(modelType).primary
+
+	var identifiers []ResourceIdentifier
+	if nodes != nil {
+		identifiers = make([]ResourceIdentifier, 0, len(nodes))
+	}
+	models := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(modelType)), 0, len(nodes))
+
+	for i, n := range nodes {
+		nodePointer := pointer + "/data"
+		if field.isToMany {
+			nodePointer += "/" + strconv.Itoa(i)
+		}
+
+		if primary != nil && n.Type != primary.name {
+			err := state.report(newUnmarshalError(nodePointer+"/type", loc.fieldPath(field), field.structField.Type, fmt.Errorf(
+				"Trying to Unmarshal an object of type %#v, but %#v does not match",
+				n.Type,
+				primary.name,
+			)))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		identifiers = append(identifiers, ResourceIdentifier{Type: n.Type, ID: n.ID})
+
+		// Only the resources held by the document are loaded
+		if _, ok := state.model(n, reflect.PtrTo(modelType)); !ok && !state.isIncluded(n) {
+			if !state.isResolved(n) {
+				state.reportUnresolved(n, nodePointer)
+			}
+			continue
+		}
+
+		m := reflect.New(modelType)
+		if err := unmarshalNodeMaybeChoice(&m, n, annotationRelation, nil, state, nodePointer); err != nil {
+			return err
+		}
+		models = reflect.Append(models, m)
+	}
+
+	if field.isToMany {
+		fieldValue.FieldByName("Linkage").Set(reflect.ValueOf(identifiers))
+		if models.Len() > 0 {
+			data.Set(models)
+		}
+	} else if len(identifiers) > 0 {
+		fieldValue.FieldByName("Linkage").Set(reflect.ValueOf(&identifiers[0]))
+		if models.Len() > 0 {
+			data.Set(models.Index(0))
+		}
+	}
+	fieldValue.FieldByName("Links").Set(reflect.ValueOf(relLinks))
+	fieldValue.FieldByName("Meta").Set(reflect.ValueOf(relMeta))
+
+	return nil
+}
@@ -0,0 +1,247 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalPayload_relationshipValues(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "libraries",
+			"id": "1",
+			"relationships": {
+				"curator": {
+					"data": {"type": "authors", "id": "1"},
+					"links": {"related": "http://example.com/libraries/1/curator"},
+					"meta": {"since": 2020}
+				},
+				"novels": {
+					"data": [{"type": "novels", "id": "1"}, {"type": "novels", "id": "2"}],
+					"meta": {"count": 2}
+				},
+				"founder": {
+					"links": {"related": "http://example.com/libraries/1/founder"}
+				}
+			}
+		},
+		"included": [
+			{"type": "novels", "id": "2", "attributes": {"title": "Dune Messiah"}}
+		]
+	}`)
+	library := new(Library)
+
+	if err := UnmarshalPayload(in, library, DisallowUnknownMembers()); err != nil {
+		t.Fatal(err)
+	}
+
+	curator := library.Curator
+	if !reflect.DeepEqual(curator.Linkage, &ResourceIdentifier{Type: "authors", ID: "1"}) {
+		t.Errorf("Unexpected curator linkage %+v", curator.Linkage)
+	}
+	if curator.Loaded() || curator.Data != nil {
+		t.Errorf("Expected the curator not to be loaded, got %+v", curator.Data)
+	}
+	if (*curator.Links)["related"] != "http://example.com/libraries/1/curator" || (*curator.Meta)["since"] != float64(2020) {
+		t.Errorf("Unexpected curator links %v and meta %v", curator.Links, curator.Meta)
+	}
+
+	novels := library.Novels
+	expected := []ResourceIdentifier{{Type: "novels", ID: "1"}, {Type: "novels", ID: "2"}}
+	if !reflect.DeepEqual(novels.Linkage, expected) {
+		t.Errorf("Unexpected novels linkage %+v", novels.Linkage)
+	}
+	if novels.Loaded() || len(novels.Data) != 1 || novels.Data[0].Title != "Dune Messiah" {
+		t.Errorf("Expected only the included novel to be loaded, got %+v", novels.Data)
+	}
+	if novels.Links != nil || (*novels.Meta)["count"] != float64(2) {
+		t.Errorf("Unexpected novels links %v and meta %v", novels.Links, novels.Meta)
+	}
+
+	founder := library.Founder
+	if founder.Linkage != nil || founder.Data != nil || founder.Links == nil {
+		t.Errorf("Expected the founder to only have links, got %+v", founder)
+	}
+	if library.Branches.Linkage != nil || library.Branches.Data != nil {
+		t.Errorf("Expected no branches, got %+v", library.Branches)
+	}
+}
+
+func TestUnmarshalPayload_relationshipValueTypeMismatch(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "libraries",
+			"id": "1",
+			"relationships": {"curator": {"data": {"type": "novels", "id": "1"}}}
+		}
+	}`)
+
+	err := UnmarshalPayload(in, new(Library))
+
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/relationships/curator/data/type" {
+		t.Fatalf("Expected an *UnmarshalError at the linkage type, got %v", err)
+	}
+}
+
+func TestUnmarshalPayload_relationErrorBeforeRelationshipValue(t *testing.T) {
+	// The error of the posts relation must not be cleared by the curator,
+	// a ToOne that is unmarshaled after it
+	in := strings.NewReader(`{
+		"data": {
+			"type": "profiles",
+			"id": "1",
+			"relationships": {
+				"posts": {"data": [{"type": "blogs", "id": "1"}]},
+				"curator": {"data": {"type": "authors", "id": "1"}}
+			}
+		}
+	}`)
+
+	err := UnmarshalPayload(in, new(Profile))
+
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/relationships/posts/data/0/type" {
+		t.Fatalf("Expected an *UnmarshalError at the posts linkage type, got %v", err)
+	}
+}
+
+func TestMarshalPayload_relationshipValues(t *testing.T) {
+	library := &Library{
+		ID: "1",
+		Curator: ToOne[Author]{
+			Data: &Author{ID: "1", Name: "Frank Herbert"},
+			Meta: &Meta{"since": 2020},
+		},
+		Novels: ToMany[Novel]{
+			Linkage: []ResourceIdentifier{{Type: "novels", ID: "1"}, {Type: "novels", ID: "2"}},
+			Data:    []*Novel{{ID: "2", Title: "Dune Messiah"}},
+			Links:   &Links{"related": "http://example.com/libraries/1/novels"},
+		},
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, library); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload struct {
+		Data struct {
+			Relationships map[string]json.RawMessage `json:"relationships"`
+		} `json:"data"`
+		Included []*Node `json:"included"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		"curator": `{"data":{"type":"authors","id":"1"},"meta":{"since":2020}}`,
+		"novels":  `{"data":[{"type":"novels","id":"1"},{"type":"novels","id":"2"}],"links":{"related":"http://example.com/libraries/1/novels"}}`,
+	} {
+		if actual := string(payload.Data.Relationships[name]); actual != expected {
+			t.Errorf("Expected %s to be %s, got %s", name, expected, actual)
+		}
+	}
+	for _, name := range []string{"founder", "branches"} {
+		if _, ok := payload.Data.Relationships[name]; ok {
+			t.Errorf("Expected empty %s to be omitted", name)
+		}
+	}
+
+	var keys []string
+	for _, n := range payload.Included {
+		keys = append(keys, n.Type+","+n.ID)
+	}
+	if len(keys) != 2 || !strings.Contains(strings.Join(keys, " "), "authors,1") || !strings.Contains(strings.Join(keys, " "), "novels,2") {
+		t.Errorf("Expected the loaded resources to be included, got %v", keys)
+	}
+}
+
+func TestMarshalPayload_unlinkedRelationshipData(t *testing.T) {
+	// Data holds models that the linkage does not identify, including one
+	// whose own related resources would otherwise be sideloaded
+	stray := &Novel{ID: "3", Title: "Children of Dune", Author: &Author{ID: "2", Name: "Brian Herbert"}}
+	library := &Library{
+		ID: "1",
+		Curator: ToOne[Author]{
+			Linkage: &ResourceIdentifier{Type: "authors", ID: "1"},
+			Data:    &Author{ID: "3", Name: "Kevin J. Anderson"},
+		},
+		Novels: ToMany[Novel]{
+			Linkage: []ResourceIdentifier{{Type: "novels", ID: "2"}},
+			Data:    []*Novel{{ID: "2", Title: "Dune Messiah"}, stray},
+		},
+	}
+
+	payload, err := Marshal(library)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := payload.(*OnePayload)
+
+	if e, a := []string{"novels,2"}, includedKeys(one.Included); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected included %v, got %v", e, a)
+	}
+
+	curator := one.Data.Relationships["curator"].(*RelationshipOneNode)
+	if curator.Data == nil || curator.Data.Type != "authors" || curator.Data.ID != "1" {
+		t.Fatalf("Expected the curator linkage, got %+v", curator.Data)
+	}
+	novels := one.Data.Relationships["novels"].(*RelationshipManyNode)
+	if e, a := []string{"novels,2"}, includedKeys(novels.Data); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected novels linkage %v, got %v", e, a)
+	}
+}
+
+func TestMarshalPayload_emptyRelationshipValues(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, &Library{ID: "1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload struct {
+		Data struct {
+			Relationships map[string]json.RawMessage `json:"relationships"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := string(payload.Data.Relationships["curator"]); actual != `{"data":null}` {
+		t.Errorf("Expected a null curator, got %s", actual)
+	}
+	if actual := string(payload.Data.Relationships["novels"]); actual != `{"data":[]}` {
+		t.Errorf("Expected no novels, got %s", actual)
+	}
+}
+
+func TestRelationshipValues_roundTrip(t *testing.T) {
+	library := &Library{
+		ID:      "1",
+		Curator: ToOne[Author]{Data: &Author{ID: "1", Name: "Frank Herbert", Novels: []*Novel{}}},
+		Novels:  ToMany[Novel]{Data: []*Novel{{ID: "1", Title: "Dune"}}},
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, library); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded := new(Library)
+	if err := UnmarshalPayload(out, decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if !decoded.Curator.Loaded() || decoded.Curator.Data.Name != "Frank Herbert" {
+		t.Errorf("Unexpected curator %+v", decoded.Curator)
+	}
+	if !decoded.Novels.Loaded() || len(decoded.Novels.Data) != 1 || decoded.Novels.Data[0].Title != "Dune" {
+		t.Errorf("Unexpected novels %+v", decoded.Novels)
+	}
+}
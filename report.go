@@ -0,0 +1,171 @@
+package jsonapi
+
+import (
+	"sort"
+	"strings"
+)
+
+// UnmarshalReport describes which members of a document were unmarshaled into
+// the model and which were left out. It is filled in by the unmarshal
+// functions given the Report option:
+//
+//	var report jsonapi.UnmarshalReport
+//	err := jsonapi.UnmarshalPayload(r.Body, blog, jsonapi.Report(&report))
+//
+//	for _, field := range report.Fields("/data") {
+//		// field was sent by the client, e.g. "Title"
+//	}
+//
+// Members are listed in the order they were unmarshaled in. The members of
+// nested attribute structs and of included resources are reported too, and
+// are told apart by their JSON Pointer.
+type UnmarshalReport struct {
+	// Present holds the attributes and relationships of the document that
+	// have a matching struct field, including those set to null.
+	Present []ReportedMember
+	// Ignored holds the attributes, relationships and top-level members of
+	// the document that have no matching struct field, and were ignored.
+	Ignored []ReportedMember
+	// DroppedPolyrelations holds the resources of polyrelations whose type
+	// has no matching choice field, and were dropped.
+	DroppedPolyrelations []ReportedResource
+	// Unresolved holds the resources of relationships that are neither in the
+	// "included" array nor in the primary data, and were unmarshaled from
+	// their linkage alone.
+	Unresolved []ReportedResource
+}
+
+// ReportedMember is a member of a document listed in an UnmarshalReport.
+type ReportedMember struct {
+	// Pointer is the JSON Pointer (RFC6901) of the member, e.g.
+	// "/data/attributes/title".
+	Pointer string
+	// Name is the name of the member, e.g. "title".
+	Name string
+	// Field is the dot separated path of the struct field the member was
+	// unmarshaled into, e.g. "Title" or "Boss.Name". It is empty for ignored
+	// members.
+	Field string
+}
+
+// ReportedResource is a resource of a document listed in an UnmarshalReport.
+type ReportedResource struct {
+	// Pointer is the JSON Pointer (RFC6901) of the resource identifier, e.g.
+	// "/data/relationships/media/data/0".
+	Pointer string
+	Type    string
+	ID      string
+}
+
+// Fields returns the struct fields of the resource found at pointer, e.g.
+// "/data" or "/data/0", whose attribute or relationship is present in the
+// document, in the order they were unmarshaled in. Fields of nested
+// attribute structs are returned by their dot separated path, e.g.
+// "Boss.Name".
+func (r *UnmarshalReport) Fields(pointer string) []string {
+	fields := []string{}
+	for _, m := range r.Present {
+		rest := strings.TrimPrefix(m.Pointer, pointer+"/")
+		if rest == m.Pointer {
+			continue
+		}
+		if strings.HasPrefix(rest, "attributes/") || strings.HasPrefix(rest, "relationships/") {
+			fields = append(fields, m.Field)
+		}
+	}
+	return fields
+}
+
+// Has reports whether the struct field, given by its dot separated path, of
+// the resource found at pointer is present in the document.
+func (r *UnmarshalReport) Has(pointer, field string) bool {
+	for _, f := range r.Fields(pointer) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Report fills report in with the members of the document that were
+// unmarshaled into the model and those that were left out. report is reset
+// first.
+func Report(report *UnmarshalReport) UnmarshalOption {
+	return func(o *unmarshalOptions) {
+		*report = UnmarshalReport{}
+		o.report = report
+	}
+}
+
+// reportPresent records the member named after field, unmarshaled into it.
+// pointer returns the JSON Pointer of a member given its name.
+func (s *unmarshalState) reportPresent(pointer func(string) string, field *fieldPlan, loc location) {
+	if s == nil || s.opts.report == nil {
+		return
+	}
+	s.opts.report.Present = append(s.opts.report.Present, ReportedMember{
+		Pointer: pointer(field.name),
+		Name:    field.name,
+		Field:   loc.fieldPath(field),
+	})
+}
+
+// reportIgnored records each of the given member names that is not found in
+// known. pointer returns the JSON Pointer of a member given its name.
+func (s *unmarshalState) reportIgnored(names []string, known map[string]struct{}, pointer func(string) string) {
+	if s == nil || s.opts.report == nil {
+		return
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := known[name]; ok {
+			continue
+		}
+		s.opts.report.Ignored = append(s.opts.report.Ignored, ReportedMember{
+			Pointer: pointer(name),
+			Name:    name,
+		})
+	}
+}
+
+// reportDropped records n, the resource found at pointer, as a dropped
+// polyrelation resource.
+func (s *unmarshalState) reportDropped(n *Node, pointer string) {
+	if s == nil || s.opts.report == nil {
+		return
+	}
+	s.opts.report.DroppedPolyrelations = append(s.opts.report.DroppedPolyrelations, ReportedResource{
+		Pointer: pointer,
+		Type:    n.Type,
+		ID:      n.ID,
+	})
+}
+
+// reportUnresolved records n, the resource found at pointer, as unresolved.
+func (s *unmarshalState) reportUnresolved(n *Node, pointer string) {
+	if s == nil || s.opts.report == nil {
+		return
+	}
+	s.opts.report.Unresolved = append(s.opts.report.Unresolved, ReportedResource{
+		Pointer: pointer,
+		Type:    n.Type,
+		ID:      n.ID,
+	})
+}
+
+// dropResolved removes the resources of the primary data from the unresolved
+// resources of the report. When streaming, a relationship may link to a
+// resource of the primary data that has not been read yet.
+func (s *unmarshalState) dropResolved() {
+	if s == nil || s.opts.report == nil {
+		return
+	}
+	unresolved := s.opts.report.Unresolved[:0]
+	for _, r := range s.opts.report.Unresolved {
+		if _, ok := s.primary[resourceKey{typ: r.Type, id: r.ID}]; !ok {
+			unresolved = append(unresolved, r)
+		}
+	}
+	s.opts.report.Unresolved = unresolved
+}
@@ -0,0 +1,141 @@
+package jsonapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalReport(t *testing.T) {
+	in := `{
+		"data": {
+			"type": "blogs",
+			"id": "1",
+			"attributes": {"title": "Hello", "view_count": null, "color": "red"},
+			"relationships": {
+				"posts": {"data": [{"type": "posts", "id": "1"}, {"type": "posts", "id": "2"}]},
+				"owner": {"data": {"type": "people", "id": "1"}}
+			}
+		},
+		"included": [
+			{"type": "posts", "id": "1", "attributes": {"title": "Foo", "rating": 5}}
+		],
+		"extra": true
+	}`
+
+	var report UnmarshalReport
+	blog := new(Blog)
+	if err := UnmarshalPayload(strings.NewReader(in), blog, Report(&report)); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedPresent := []ReportedMember{
+		{Pointer: "/data/attributes/title", Name: "title", Field: "Title"},
+		{Pointer: "/data/relationships/posts", Name: "posts", Field: "Posts"},
+		{Pointer: "/included/0/attributes/title", Name: "title", Field: "Title"},
+		{Pointer: "/data/attributes/view_count", Name: "view_count", Field: "ViewCount"},
+	}
+	if !reflect.DeepEqual(report.Present, expectedPresent) {
+		t.Fatalf("Expected present members\n%+v\ngot\n%+v", expectedPresent, report.Present)
+	}
+
+	expectedIgnored := []ReportedMember{
+		{Pointer: "/extra", Name: "extra"},
+		{Pointer: "/included/0/attributes/rating", Name: "rating"},
+		{Pointer: "/data/attributes/color", Name: "color"},
+		{Pointer: "/data/relationships/owner", Name: "owner"},
+	}
+	if !reflect.DeepEqual(report.Ignored, expectedIgnored) {
+		t.Fatalf("Expected ignored members\n%+v\ngot\n%+v", expectedIgnored, report.Ignored)
+	}
+
+	expectedUnresolved := []ReportedResource{
+		{Pointer: "/data/relationships/posts/data/1", Type: "posts", ID: "2"},
+	}
+	if !reflect.DeepEqual(report.Unresolved, expectedUnresolved) {
+		t.Fatalf("Expected unresolved resources %+v, got %+v", expectedUnresolved, report.Unresolved)
+	}
+
+	if e, a := []string{"Title", "Posts", "ViewCount"}, report.Fields("/data"); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected fields %v, got %v", e, a)
+	}
+	if !report.Has("/data", "ViewCount") || report.Has("/data", "CreatedAt") {
+		t.Fatalf("Unexpected fields %v", report.Fields("/data"))
+	}
+}
+
+func TestUnmarshalReport_nestedAttributes(t *testing.T) {
+	in := `{
+		"data": {
+			"type": "companies",
+			"id": "1",
+			"attributes": {"boss": {"firstname": "Jane", "nickname": "JJ"}}
+		}
+	}`
+
+	var report UnmarshalReport
+	if err := UnmarshalPayload(strings.NewReader(in), new(Company), Report(&report)); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, a := []string{"Boss", "Boss.Firstname"}, report.Fields("/data"); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected fields %v, got %v", e, a)
+	}
+	expectedIgnored := []ReportedMember{{Pointer: "/data/attributes/boss/nickname", Name: "nickname"}}
+	if !reflect.DeepEqual(report.Ignored, expectedIgnored) {
+		t.Fatalf("Expected ignored members %+v, got %+v", expectedIgnored, report.Ignored)
+	}
+}
+
+func TestUnmarshalReport_droppedPolyrelations(t *testing.T) {
+	in := `{
+		"data": {
+			"type": "blogs",
+			"id": "1",
+			"relationships": {
+				"media": {"data": [{"type": "images", "id": "1"}, {"type": "audio", "id": "2"}]}
+			}
+		},
+		"included": [
+			{"type": "images", "id": "1", "attributes": {"src": "hello.png"}}
+		]
+	}`
+
+	report := UnmarshalReport{Unresolved: []ReportedResource{{Type: "stale"}}}
+	if err := UnmarshalPayload(strings.NewReader(in), new(BlogPostWithPoly), Report(&report)); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []ReportedResource{{Pointer: "/data/relationships/media/data/1", Type: "audio", ID: "2"}}
+	if !reflect.DeepEqual(report.DroppedPolyrelations, expected) {
+		t.Fatalf("Expected dropped resources %+v, got %+v", expected, report.DroppedPolyrelations)
+	}
+	if len(report.Unresolved) != 0 {
+		t.Fatalf("Expected the report to be reset, got %+v", report.Unresolved)
+	}
+}
+
+func TestUnmarshalReport_many(t *testing.T) {
+	in := `{
+		"data": [
+			{"type": "blogs", "id": "1", "attributes": {"title": "First"}, "relationships": {"current_post": {"data": {"type": "posts", "id": "1"}}}},
+			{"type": "blogs", "id": "2", "attributes": {"view_count": 3}}
+		]
+	}`
+
+	var report UnmarshalReport
+	if _, err := UnmarshalManyPayload(strings.NewReader(in), reflect.TypeOf(new(Blog)), Report(&report)); err != nil {
+		t.Fatal(err)
+	}
+
+	if e, a := []string{"Title", "CurrentPost"}, report.Fields("/data/0"); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected fields %v, got %v", e, a)
+	}
+	if e, a := []string{"ViewCount"}, report.Fields("/data/1"); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected fields %v, got %v", e, a)
+	}
+	expected := []ReportedResource{{Pointer: "/data/0/relationships/current_post/data", Type: "posts", ID: "1"}}
+	if !reflect.DeepEqual(report.Unresolved, expected) {
+		t.Fatalf("Expected unresolved resources %+v, got %+v", expected, report.Unresolved)
+	}
+}
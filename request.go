@@ -2,11 +2,15 @@ package jsonapi
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -34,8 +38,36 @@ var (
 	ErrInvalidType = errors.New("Invalid type provided") // I wish we used punctuation.
 	// ErrTypeNotFound is returned when the given type not found on the model.
 	ErrTypeNotFound = errors.New("no primary type annotation found on model")
+	// ErrUnknownMember is returned when unmarshaling with the
+	// DisallowUnknownMembers option and the document has a member that is not
+	// defined by the model.
+	ErrUnknownMember = errors.New("member is not defined by the model")
+	// ErrUnknownType is returned when unmarshaling with the
+	// DisallowUnknownMembers option and the document has a resource whose type
+	// is not defined by the model.
+	ErrUnknownType = errors.New("resource type is not defined by the model")
+	// ErrNumberOverflow is returned when a number in the document is out of
+	// range for the numeric type of its struct field.
+	ErrNumberOverflow = errors.New("number overflows the struct field type")
+	// ErrNumberPrecision is returned when a number in the document cannot be
+	// represented exactly by the integer type of its struct field, e.g. when
+	// it has a fraction.
+	ErrNumberPrecision = errors.New("number cannot be represented exactly by the struct field type")
 )
 
+var jsonNumberType = reflect.TypeOf(json.Number(""))
+
+// topLevelMembers holds the members the JSON API spec defines for the
+// top-level object of a document.
+var topLevelMembers = map[string]struct{}{
+	"data":     {},
+	"errors":   {},
+	"meta":     {},
+	"jsonapi":  {},
+	"links":    {},
+	"included": {},
+}
+
 // ErrUnsupportedPtrType is returned when the Struct field was a pointer but
 // the JSON value was of a different type
 type ErrUnsupportedPtrType struct {
@@ -92,54 +124,206 @@ func newErrUnsupportedPtrType(rf reflect.Value, t reflect.Type, structField refl
 // Visit https://github.com/google/jsonapi#create for more info.
 //
 // model interface{} should be a pointer to a struct.
-func UnmarshalPayload(in io.Reader, model interface{}) error {
+func UnmarshalPayload(in io.Reader, model interface{}, opts ...UnmarshalOption) error {
+	_, err := unmarshalOnePayload(in, model, newUnmarshalOptions(opts))
+	return err
+}
+
+func unmarshalOnePayload(in io.Reader, model interface{}, o *unmarshalOptions) (*OnePayload, error) {
 	payload := new(OnePayload)
 
-	if err := json.NewDecoder(in).Decode(payload); err != nil {
-		return err
+	members, err := decodePayload(newLimitReader(in, o.limits, false), payload, reflect.TypeOf(model), o)
+	if err != nil {
+		return nil, err
 	}
 
-	if payload.Included != nil {
-		includedMap := make(map[string]*Node)
-		for _, included := range payload.Included {
-			key := fmt.Sprintf("%s,%s", included.Type, included.ID)
-			includedMap[key] = included
+	state := newUnmarshalState(payload.Included, o)
+
+	if o.patch {
+		if err := checkPatchTarget(payload.Data, reflect.ValueOf(model)); err != nil {
+			return nil, err
 		}
+		state.rememberRelated(reflect.ValueOf(model))
+	}
 
-		return unmarshalNode(payload.Data, reflect.ValueOf(model), &includedMap)
+	if err := state.reportUnknownMembers(members, topLevelMembers, topLevelPointer); err != nil {
+		return nil, err
 	}
-	return unmarshalNode(payload.Data, reflect.ValueOf(model), nil)
+	state.reportIgnored(members, topLevelMembers, topLevelPointer)
+
+	normalizeTopLevel(payload.Links, payload.Meta, payload.JSONAPI)
+
+	state.rememberPrimary(payload.Data, reflect.ValueOf(model))
+
+	if err := unmarshalNode(payload.Data, reflect.ValueOf(model), state, location{pointer: "/data"}); err != nil {
+		return nil, err
+	}
+
+	if err := state.reportUnknownIncluded(payload.Included, reflect.TypeOf(model)); err != nil {
+		return nil, err
+	}
+
+	if err := state.err(); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
 }
 
 // UnmarshalManyPayload converts an io into a set of struct instances using
-// jsonapi tags on the type's struct fields.
-func UnmarshalManyPayload(in io.Reader, t reflect.Type) ([]interface{}, error) {
+// jsonapi tags on the type's struct fields. t should be the type of a pointer
+// to a struct, e.g. reflect.TypeOf(new(Blog)); ErrUnexpectedType is returned
+// otherwise.
+func UnmarshalManyPayload(in io.Reader, t reflect.Type, opts ...UnmarshalOption) ([]interface{}, error) {
+	models, _, err := unmarshalManyPayload(in, t, newUnmarshalOptions(opts))
+	return models, err
+}
+
+func unmarshalManyPayload(in io.Reader, t reflect.Type, o *unmarshalOptions) ([]interface{}, *ManyPayload, error) {
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, nil, ErrUnexpectedType
+	}
+
 	payload := new(ManyPayload)
 
-	if err := json.NewDecoder(in).Decode(payload); err != nil {
+	members, err := decodePayload(newLimitReader(in, o.limits, false), payload, t, o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	models := []interface{}{}                       // will be populated from the "data"
+	state := newUnmarshalState(payload.Included, o) // will be populate from the "included"
+
+	if err := state.reportUnknownMembers(members, topLevelMembers, topLevelPointer); err != nil {
+		return nil, nil, err
+	}
+	state.reportIgnored(members, topLevelMembers, topLevelPointer)
+
+	normalizeTopLevel(payload.Links, payload.Meta, payload.JSONAPI)
+
+	// Every model of the primary data is remembered up front, so that
+	// relationships to any of them resolve to the same instance
+	values := make([]reflect.Value, len(payload.Data))
+	for i, data := range payload.Data {
+		values[i] = reflect.New(t.Elem())
+		state.rememberPrimary(data, values[i])
+	}
+
+	for i, data := range payload.Data {
+		err := unmarshalNode(data, values[i], state, location{pointer: "/data/" + strconv.Itoa(i)})
+		if err != nil {
+			return nil, nil, err
+		}
+		models = append(models, values[i].Interface())
+	}
+
+	if err := state.reportUnknownIncluded(payload.Included, t); err != nil {
+		return nil, nil, err
+	}
+
+	if err := state.err(); err != nil {
+		return nil, nil, err
+	}
+
+	return models, payload, nil
+}
+
+// decodePayload decodes the document read from in, whose model type is t,
+// into payload. When unknown members are disallowed or reported, it also
+// returns the names of the members of the top-level object, to be checked
+// against the spec.
+func decodePayload(in io.Reader, payload interface{}, t reflect.Type, opts *unmarshalOptions) ([]string, error) {
+	if !opts.disallowUnknownMembers && opts.report == nil && !opts.lenient {
+		return nil, decodeJSON(in, payload)
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
 		return nil, err
 	}
 
-	models := []interface{}{}         // will be populated from the "data"
-	includedMap := map[string]*Node{} // will be populate from the "included"
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
 
-	if payload.Included != nil {
-		for _, included := range payload.Included {
-			key := fmt.Sprintf("%s,%s", included.Type, included.ID)
-			includedMap[key] = included
+	if opts.lenient {
+		if data, err = coerceDocument(data, t, opts); err != nil {
+			return nil, err
 		}
 	}
 
-	for _, data := range payload.Data {
-		model := reflect.New(t.Elem())
-		err := unmarshalNode(data, model, &includedMap)
+	if err := decodeJSON(bytes.NewReader(data), payload); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// decodeJSON decodes the JSON value read from in into v, keeping numbers as
+// json.Number so that they can later be converted into the numeric type of
+// their struct field without loss of precision.
+func decodeJSON(in io.Reader, v interface{}) error {
+	d := json.NewDecoder(in)
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// normalizeNumbers replaces, in place, every json.Number found in v by its
+// float64 value, as encoding/json would have decoded it. It is used where
+// decoded values are handed over as is, e.g. to interface{} fields or as
+// meta, so that these keep holding float64 numbers.
+func normalizeNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
 		if err != nil {
-			return nil, err
+			return v
+		}
+		return f
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = normalizeNumbers(e)
+		}
+	case []interface{}:
+		for i, e := range v {
+			v[i] = normalizeNumbers(e)
 		}
-		models = append(models, model.Interface())
 	}
+	return v
+}
 
-	return models, nil
+// normalizeTopLevel normalizes the numbers of the top-level links, meta and
+// jsonapi object of a document.
+func normalizeTopLevel(links *Links, meta *Meta, jsonapi *JSONAPIObject) {
+	if links != nil {
+		normalizeNumbers(map[string]interface{}(*links))
+	}
+	if meta != nil {
+		normalizeNumbers(map[string]interface{}(*meta))
+	}
+	if jsonapi != nil && jsonapi.Meta != nil {
+		normalizeNumbers(map[string]interface{}(*jsonapi.Meta))
+	}
+}
+
+// normalizeNodes normalizes the numbers of the members of nodes, once they
+// have been unmarshaled, before they are handed over as is.
+func normalizeNodes(nodes []*Node) {
+	for _, n := range nodes {
+		normalizeNumbers(n.Attributes)
+		normalizeNumbers(n.Relationships)
+		normalizeTopLevel(n.Links, n.Meta, nil)
+	}
+}
+
+func topLevelPointer(name string) string {
+	return "/" + escapePointerToken(name)
 }
 
 // jsonapiTypeOfModel returns a jsonapi primary type string
@@ -154,22 +338,15 @@ func UnmarshalManyPayload(in io.Reader, t reflect.Type) ([]interface{}, error) {
 //	    ID string `jsonapi:"primary,posts"`
 //	}
 func jsonapiTypeOfModel(structModel reflect.Type) (string, error) {
-	for i := 0; i < structModel.NumField(); i++ {
-		fieldType := structModel.Field(i)
-		args, err := getStructTags(fieldType)
-
-		// A jsonapi tag was found, but it was improperly structured
-		if err != nil {
-			return "", err
-		}
+	plan := typePlanFor(structModel)
 
-		if len(args) < 2 {
-			continue
-		}
+	if plan.primary != nil {
+		return plan.primary.name, nil
+	}
 
-		if args[0] == annotationPrimary {
-			return args[1], nil
-		}
+	// A jsonapi tag was found, but it was improperly structured
+	if plan.err != nil {
+		return "", plan.err
 	}
 
 	return "", ErrTypeNotFound
@@ -207,63 +384,299 @@ type structFieldIndex struct {
 //	}
 //
 // where `"videos"` is the value of the `primary` annotation on the `Video` model
-func choiceStructMapping(choice reflect.Type) (result map[string]structFieldIndex) {
-	result = make(map[string]structFieldIndex)
+func choiceStructMapping(choice reflect.Type) map[string]structFieldIndex {
+	return choicePlanFor(choice).mapping
+}
+
+func getStructTags(field reflect.StructField) ([]string, error) {
+	tag := field.Tag.Get("jsonapi")
+	if tag == "" {
+		return []string{}, nil
+	}
 
-	for choice.Kind() != reflect.Struct {
-		choice = choice.Elem()
+	args := strings.Split(tag, ",")
+	if len(args) < 1 {
+		return nil, ErrBadJSONAPIStructTag
 	}
 
-	for i := 0; i < choice.NumField(); i++ {
-		fieldType := choice.Field(i)
+	annotation := args[0]
 
-		// Must be a pointer
-		if fieldType.Type.Kind() != reflect.Ptr {
+	if (annotation == annotationClientID && len(args) != 1) ||
+		(annotation != annotationClientID && annotation != annotationMeta && len(args) < 2) {
+		return nil, ErrBadJSONAPIStructTag
+	}
+
+	return args, nil
+}
+
+// unmarshalState holds the state shared by every node unmarshaled from a
+// single document.
+type unmarshalState struct {
+	// included maps the key of each resource of the "included" array to
+	// that resource.
+	included map[resourceKey]*Node
+	// includedPointers maps the same keys to the JSON Pointer of the resource.
+	includedPointers map[resourceKey]string
+	// models maps the resources unmarshaled so far to their model, so that
+	// every reference to a resource resolves to the same instance and cyclic
+	// graphs of included resources are only walked once.
+	models map[modelKey]reflect.Value
+	// primary holds the keys of the resources of the primary data.
+	primary map[resourceKey]struct{}
+	// includedOnly is set when streaming, so that models holds the models
+	// of the included resources only and does not grow with the primary
+	// data.
+	includedOnly bool
+
+	opts *unmarshalOptions
+	// errs collects the errors reported while unmarshaling with the
+	// CollectErrors option.
+	errs UnmarshalErrors
+}
+
+// modelKey identifies the model a resource was unmarshaled into. The same
+// resource may be unmarshaled into models of different types, e.g. through a
+// relation and a polyrelation, and each gets its own instance.
+type modelKey struct {
+	resource resourceKey
+	typ      reflect.Type
+}
+
+func newUnmarshalState(included []*Node, opts *unmarshalOptions) *unmarshalState {
+	state := &unmarshalState{
+		included:         make(map[resourceKey]*Node, len(included)),
+		includedPointers: make(map[resourceKey]string, len(included)),
+		models:           map[modelKey]reflect.Value{},
+		primary:          map[resourceKey]struct{}{},
+		opts:             opts,
+	}
+	state.include(included)
+
+	return state
+}
+
+// include makes the resources of the "included" array available to the
+// relationships unmarshaled from then on.
+func (s *unmarshalState) include(included []*Node) {
+	for i, n := range included {
+		key := nodeKey(n)
+		s.included[key] = n
+		s.includedPointers[key] = "/included/" + strconv.Itoa(i)
+	}
+}
+
+// model returns the model of type t the resource n was already unmarshaled
+// into, if any.
+func (s *unmarshalState) model(n *Node, t reflect.Type) (reflect.Value, bool) {
+	if s == nil || n == nil || n.ID == "" {
+		return reflect.Value{}, false
+	}
+	model, ok := s.models[modelKey{resource: nodeKey(n), typ: t}]
+	return model, ok
+}
+
+// remember records model as the instance the resource n is unmarshaled into.
+// Resources without an ID cannot be told apart and are not recorded, nor are
+// the resources outside of the "included" array when streaming.
+func (s *unmarshalState) remember(n *Node, model reflect.Value) {
+	if s == nil || n == nil || n.ID == "" || (s.includedOnly && !s.isIncluded(n)) {
+		return
+	}
+	s.models[modelKey{resource: nodeKey(n), typ: model.Type()}] = model
+}
+
+// rememberPrimary records model as the instance n, a resource of the primary
+// data, is unmarshaled into.
+func (s *unmarshalState) rememberPrimary(n *Node, model reflect.Value) {
+	s.remember(n, model)
+	if n != nil && n.ID != "" {
+		s.primary[nodeKey(n)] = struct{}{}
+	}
+}
+
+// isIncluded reports whether the resource n is part of the "included" array.
+func (s *unmarshalState) isIncluded(n *Node) bool {
+	return s != nil && s.included[nodeKey(n)] != nil
+}
+
+// isResolved reports whether the resource n, the target of a relationship, is
+// held by the document, either in the "included" array or in the primary
+// data.
+func (s *unmarshalState) isResolved(n *Node) bool {
+	if s == nil || s.isIncluded(n) {
+		return true
+	}
+	_, ok := s.primary[nodeKey(n)]
+	return ok
+}
+
+// report records err, an error raised while unmarshaling a member of the
+// document. It returns err if unmarshaling should stop, or nil if errors are
+// being collected and unmarshaling should carry on with the next member.
+// Errors that are not caused by the document, e.g. malformed struct tags,
+// always stop unmarshaling.
+func (s *unmarshalState) report(err error) error {
+	if s == nil || !s.opts.collectErrors {
+		return err
+	}
+
+	var ue *UnmarshalError
+	if !errors.As(err, &ue) {
+		return err
+	}
+
+	s.errs = append(s.errs, ue)
+	return nil
+}
+
+// reportUnknownMembers reports an ErrUnknownMember for each of the given
+// member names that is not found in known, when unknown members are
+// disallowed. pointer returns the JSON Pointer of a member given its name.
+func (s *unmarshalState) reportUnknownMembers(names []string, known map[string]struct{}, pointer func(string) string) error {
+	if s == nil || !s.opts.disallowUnknownMembers {
+		return nil
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := known[name]; ok {
 			continue
 		}
 
-		subtype := fieldType.Type.Elem()
+		if err := s.report(&UnmarshalError{Pointer: pointer(name), Err: ErrUnknownMember}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reportUnknownIncluded reports an ErrUnknownType for each included resource
+// whose type cannot be reached through the relationships of model, when
+// unknown members are disallowed.
+func (s *unmarshalState) reportUnknownIncluded(included []*Node, model reflect.Type) error {
+	if !s.opts.disallowUnknownMembers || len(included) == 0 {
+		return nil
+	}
+
+	for model.Kind() == reflect.Ptr {
+		model = model.Elem()
+	}
+	if model.Kind() != reflect.Struct {
+		return nil
+	}
 
-		// Must be a pointer to struct
-		if subtype.Kind() != reflect.Struct {
+	types := reachableTypes(model)
+	for i, n := range included {
+		if _, ok := types[n.Type]; ok {
 			continue
 		}
 
-		if t, err := jsonapiTypeOfModel(subtype); err == nil {
-			result[t] = structFieldIndex{
-				Type:     subtype,
-				FieldNum: i,
-			}
+		err := s.report(&UnmarshalError{
+			Pointer: "/included/" + strconv.Itoa(i) + "/type",
+			Err:     fmt.Errorf("%w: %q", ErrUnknownType, n.Type),
+		})
+		if err != nil {
+			return err
 		}
 	}
 
-	return result
+	return nil
 }
 
-func getStructTags(field reflect.StructField) ([]string, error) {
-	tag := field.Tag.Get("jsonapi")
-	if tag == "" {
-		return []string{}, nil
+// err returns the errors collected while unmarshaling, or nil if there were
+// none.
+func (s *unmarshalState) err() error {
+	if len(s.errs) == 0 {
+		return nil
 	}
+	return s.errs
+}
 
-	args := strings.Split(tag, ",")
-	if len(args) < 1 {
-		return nil, ErrBadJSONAPIStructTag
+// location describes where the node being unmarshaled is found within the
+// document, so that errors can point at the offending member.
+type location struct {
+	// pointer is the JSON Pointer of the resource object, or of the attribute
+	// value when unmarshaling a nested attribute struct.
+	pointer string
+	// nested is set when the node holds the members of a nested attribute
+	// struct rather than those of a resource object.
+	nested bool
+	// field is the dot separated path of the struct fields leading to a
+	// nested attribute struct, e.g. "Boss".
+	field string
+}
+
+// fieldPath returns the dot separated path of the given struct field.
+func (l location) fieldPath(field *fieldPlan) string {
+	if l.field == "" {
+		return field.structField.Name
 	}
+	return l.field + "." + field.structField.Name
+}
 
-	annotation := args[0]
+// attributeValue returns the location of the value of the given attribute.
+func (l location) attributeValue(field *fieldPlan) location {
+	return location{
+		pointer: l.attribute(field.name),
+		nested:  true,
+		field:   l.fieldPath(field),
+	}
+}
 
-	if (annotation == annotationClientID && len(args) != 1) ||
-		(annotation != annotationClientID && len(args) < 2) {
-		return nil, ErrBadJSONAPIStructTag
+// metaValue returns the location of the value of the given member of the
+// resource meta.
+func (l location) metaValue(field *fieldPlan) location {
+	return location{
+		pointer: l.member("meta") + "/" + escapePointerToken(field.name),
+		nested:  true,
+		field:   l.fieldPath(field),
 	}
+}
 
-	return args, nil
+// index returns the location of the i-th element of the array found at l.
+func (l location) index(i int) location {
+	l.pointer += "/" + strconv.Itoa(i)
+	return l
+}
+
+// key returns the location of the value of the named member of the object
+// found at l.
+func (l location) key(name string) location {
+	l.pointer = l.member(name)
+	return l
+}
+
+// member returns the JSON Pointer of a member of the resource object, such
+// as "type" or "id".
+func (l location) member(name string) string {
+	return l.pointer + "/" + escapePointerToken(name)
+}
+
+// attribute returns the JSON Pointer of the named attribute.
+func (l location) attribute(name string) string {
+	if l.nested {
+		return l.member(name)
+	}
+	return l.pointer + "/attributes/" + escapePointerToken(name)
 }
 
+// relationship returns the JSON Pointer of the named relationship.
+func (l location) relationship(name string) string {
+	return l.pointer + "/relationships/" + escapePointerToken(name)
+}
+
+// escapePointerToken escapes a reference token of a JSON Pointer, as
+// described by RFC6901.
+func escapePointerToken(token string) string {
+	return pointerTokenReplacer.Replace(token)
+}
+
+var pointerTokenReplacer = strings.NewReplacer("~", "~0", "/", "~1")
+
 // unmarshalNodeMaybeChoice populates a model that may or may not be
 // a choice type struct that corresponds to a polyrelation or relation
-func unmarshalNodeMaybeChoice(m *reflect.Value, data *Node, annotation string, choiceTypeMapping map[string]structFieldIndex, included *map[string]*Node) error {
+func unmarshalNodeMaybeChoice(m *reflect.Value, data *Node, annotation string, choiceTypeMapping map[string]structFieldIndex, state *unmarshalState, pointer string) error {
 	// This will hold either the value of the choice type model or the actual
 	// model, depending on annotation
 	var actualModel = *m
@@ -272,22 +685,46 @@ func unmarshalNodeMaybeChoice(m *reflect.Value, data *Node, annotation string, c
 	if annotation == annotationPolyRelation {
 		c, ok := choiceTypeMapping[data.Type]
 		if !ok {
+			state.reportDropped(data, pointer)
+
 			// If there is no valid choice field to assign this type of relation,
 			// this shouldn't necessarily be an error because a newer version of
 			// the API could be communicating with an older version of the client
 			// library, in which case all choice variants would be nil.
+			if state != nil && state.opts.disallowUnknownMembers {
+				return state.report(&UnmarshalError{
+					Pointer: pointer + "/type",
+					Type:    m.Type(),
+					Err:     fmt.Errorf("%w: %q", ErrUnknownType, data.Type),
+				})
+			}
 			return nil
 		}
 		choiceElem = &c
 		actualModel = reflect.New(choiceElem.Type)
 	}
 
-	if err := unmarshalNode(
-		fullNode(data, included),
-		actualModel,
-		included,
-	); err != nil {
-		return err
+	if !state.isResolved(data) {
+		state.reportUnresolved(data, pointer)
+	}
+
+	node, pointer := fullNode(data, state, pointer)
+
+	if model, ok := state.model(node, actualModel.Type()); ok {
+		// The resource was already unmarshaled, or is being unmarshaled
+		// further up a cycle of relationships: share its instance
+		actualModel = model
+	} else {
+		state.remember(node, actualModel)
+
+		if err := unmarshalNode(
+			node,
+			actualModel,
+			state,
+			location{pointer: pointer},
+		); err != nil {
+			return err
+		}
 	}
 
 	if choiceElem != nil {
@@ -296,69 +733,45 @@ func unmarshalNodeMaybeChoice(m *reflect.Value, data *Node, annotation string, c
 		// at choiceElem.FieldNum
 		v := m.Elem()
 		v.Field(choiceElem.FieldNum).Set(actualModel)
+	} else {
+		*m = actualModel
 	}
 	return nil
 }
 
-func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node) (err error) {
+func unmarshalNode(data *Node, model reflect.Value, state *unmarshalState, loc location) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			err = fmt.Errorf("data is not a jsonapi representation of '%v'", model.Type())
+			err = state.report(&UnmarshalError{
+				Pointer: loc.pointer,
+				Field:   loc.field,
+				Type:    model.Type(),
+				Err:     fmt.Errorf("data is not a jsonapi representation of '%v'", model.Type()),
+			})
 		}
 	}()
 
 	modelValue := model.Elem()
-	modelType := modelValue.Type()
-	polyrelationFields := map[string]reflect.Type{}
+	plan := typePlanFor(modelValue.Type())
 
 	var er error
 
-	// preprocess the model to find polyrelation fields
-	for i := 0; i < modelValue.NumField(); i++ {
-		fieldValue := modelValue.Field(i)
-		fieldType := modelType.Field(i)
-
-		args, err := getStructTags(fieldType)
-		if err != nil {
-			er = err
-			break
-		}
-
-		if len(args) < 2 {
-			continue
-		}
-
-		annotation := args[0]
-		name := args[1]
-
-		if annotation == annotationPolyRelation {
-			polyrelationFields[name] = fieldValue.Type()
-		}
-	}
-
-	for i := 0; i < modelValue.NumField(); i++ {
-		fieldValue := modelValue.Field(i)
-		fieldType := modelType.Field(i)
-
-		args, err := getStructTags(fieldType)
-		if err != nil {
-			er = err
-			break
-		}
-		if len(args) == 0 {
-			continue
-		}
-		annotation := args[0]
+	for _, field := range plan.fields {
+		fieldValue := fieldByIndexAlloc(modelValue, field.index)
+		annotation := field.annotation
 
 		if annotation == annotationPrimary {
 			// Check the JSON API Type
-			if data.Type != args[1] {
-				er = fmt.Errorf(
+			if data.Type != field.name {
+				er = state.report(newUnmarshalError(loc.member("type"), loc.fieldPath(field), field.structField.Type, fmt.Errorf(
 					"Trying to Unmarshal an object of type %#v, but %#v does not match",
 					data.Type,
-					args[1],
-				)
-				break
+					field.name,
+				)))
+				if er != nil {
+					break
+				}
+				continue
 			}
 
 			if data.ID == "" {
@@ -368,37 +781,31 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 			// ID will have to be transmitted as astring per the JSON API spec
 			v := reflect.ValueOf(data.ID)
 
-			// Deal with PTRS
-			var kind reflect.Kind
-			if fieldValue.Kind() == reflect.Ptr {
-				kind = fieldType.Type.Elem().Kind()
-			} else {
-				kind = fieldType.Type.Kind()
-			}
-
 			// Handle String case
-			if kind == reflect.String {
+			if field.kind == reflect.String {
 				assign(fieldValue, v)
 				continue
 			}
 
 			// Value was not a string... only other supported type was a numeric,
-			// which would have been sent as a float value.
-			floatValue, err := strconv.ParseFloat(data.ID, 64)
-			if err != nil {
-				// Could not convert the value in the "id" attr to a float
-				er = ErrBadJSONAPIID
-				break
-			}
-
-			// Convert the numeric float to one of the supported ID numeric types
+			// which is parsed exactly into one of the supported ID numeric types
 			// (int[8,16,32,64] or uint[8,16,32,64])
-			idValue, err := handleNumeric(floatValue, fieldType.Type, fieldValue)
+			id, ok := numericID(data.ID)
+			idValue, err := handleNumeric(id, field.structField.Type, fieldValue)
+			if !ok {
+				err = ErrBadJSONAPIID
+			}
 			if err != nil {
-				// We had a JSON float (numeric), but our field was not one of the
-				// allowed numeric types
-				er = ErrBadJSONAPIID
-				break
+				// Numbers that do not fit the field are reported as such, anything
+				// else was either not a number or not a numeric field
+				if !errors.Is(err, ErrNumberOverflow) && !errors.Is(err, ErrNumberPrecision) {
+					err = ErrBadJSONAPIID
+				}
+				er = state.report(newUnmarshalError(loc.member("id"), loc.fieldPath(field), field.structField.Type, err))
+				if er != nil {
+					break
+				}
+				continue
 			}
 
 			assign(fieldValue, idValue)
@@ -415,29 +822,51 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 				continue
 			}
 
-			attribute := attributes[args[1]]
+			attribute, ok := attributes[field.name]
+			if ok {
+				state.reportPresent(loc.attribute, field, loc)
+			}
 
-			// continue if the attribute was not included in the request
+			// continue if the attribute was not included in the request, or
+			// clear it if it was sent as null in a PATCH request
 			if attribute == nil {
+				if ok && state.opts.patch {
+					clearValue(field, fieldValue)
+				}
 				continue
 			}
 
-			structField := fieldType
-			value, err := unmarshalAttribute(attribute, args, structField, fieldValue)
+			attrLoc := loc.attributeValue(field)
+			value, err := unmarshalAttribute(attribute, field, fieldValue, state, attrLoc)
 			if err != nil {
-				er = err
-				break
+				er = state.report(newUnmarshalError(attrLoc.pointer, attrLoc.field, field.structField.Type, err))
+				if er != nil {
+					break
+				}
+				continue
 			}
 
 			assign(fieldValue, value)
 		} else if annotation == annotationRelation || annotation == annotationPolyRelation {
-			isSlice := fieldValue.Type().Kind() == reflect.Slice
-
 			// No relations of the given name were provided
-			if data.Relationships == nil || data.Relationships[args[1]] == nil {
+			if data.Relationships == nil || data.Relationships[field.name] == nil {
+				continue
+			}
+			state.reportPresent(loc.relationship, field, loc)
+
+			if field.isToOne || field.isToMany {
+				if state.opts.patch {
+					fieldValue.Set(reflect.Zero(fieldValue.Type()))
+				}
+				if err := unmarshalRelationshipValue(data.Relationships[field.name], field, fieldValue, state, loc); err != nil {
+					er = err
+					break
+				}
 				continue
 			}
 
+			pointer := loc.relationship(field.name)
+
 			// If this is a polymorphic relation, each data relationship needs to be assigned
 			// to it's appropriate choice field and fieldValue should be a choice
 			// struct type field.
@@ -446,15 +875,15 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 				choiceMapping = choiceStructMapping(fieldValue.Type())
 			}
 
-			if isSlice {
+			if field.isSlice {
 				// to-many relationship
 				relationship := new(RelationshipManyNode)
 				sliceType := fieldValue.Type()
 
 				buf := bytes.NewBuffer(nil)
 
-				json.NewEncoder(buf).Encode(data.Relationships[args[1]]) //nolint:errcheck
-				json.NewDecoder(buf).Decode(relationship)                //nolint:errcheck
+				json.NewEncoder(buf).Encode(data.Relationships[field.name]) //nolint:errcheck
+				json.NewDecoder(buf).Decode(relationship)                   //nolint:errcheck
 
 				data := relationship.Data
 
@@ -462,12 +891,12 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 				// the slice of models, depending on the annotation
 				models := reflect.New(sliceType).Elem()
 
-				for _, n := range data {
+				for i, n := range data {
 					// This will hold either the value of the choice type model or the actual
 					// model, depending on annotation
 					m := reflect.New(sliceType.Elem().Elem())
 
-					err = unmarshalNodeMaybeChoice(&m, n, annotation, choiceMapping, included)
+					err = unmarshalNodeMaybeChoice(&m, n, annotation, choiceMapping, state, pointer+"/data/"+strconv.Itoa(i))
 					if err != nil {
 						er = err
 						break
@@ -475,6 +904,9 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 
 					models = reflect.Append(models, m)
 				}
+				if er != nil {
+					break
+				}
 
 				fieldValue.Set(models)
 			} else {
@@ -482,7 +914,7 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 				relationship := new(RelationshipOneNode)
 
 				buf := bytes.NewBuffer(nil)
-				relDataStr := data.Relationships[args[1]]
+				relDataStr := data.Relationships[field.name]
 				json.NewEncoder(buf).Encode(relDataStr) //nolint:errcheck
 
 				isExplicitNull := false
@@ -492,7 +924,10 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 					// this indicates disassociating the relationship
 					isExplicitNull = true
 				} else if relationshipDecodeErr != nil {
-					er = fmt.Errorf("Could not unmarshal json: %w", relationshipDecodeErr)
+					er = state.report(newUnmarshalError(pointer, loc.fieldPath(field), field.structField.Type, fmt.Errorf("Could not unmarshal json: %w", relationshipDecodeErr)))
+					if er != nil {
+						break
+					}
 				}
 
 				// This will hold either the value of the choice type model or the actual
@@ -501,7 +936,7 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 
 				// Nullable relationships have an extra pointer indirection
 				// unwind that here
-				if strings.HasPrefix(fieldType.Type.Name(), "NullableRelationship[") {
+				if field.isNullableRelationship {
 					if m.Kind() == reflect.Ptr {
 						m = reflect.New(fieldValue.Type().Elem().Elem())
 					}
@@ -515,9 +950,11 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 				if relationship.Data == nil {
 					// Explicit null supplied for the field value
 					// If a nullable relationship we set the field value to a map with a single entry
-					if isExplicitNull && strings.HasPrefix(fieldType.Type.Name(), "NullableRelationship[") {
+					if isExplicitNull && field.isNullableRelationship {
 						fieldValue.Set(reflect.MakeMapWithSize(fieldValue.Type(), 1))
 						fieldValue.SetMapIndex(reflect.ValueOf(false), m)
+					} else if isExplicitNull && state.opts.patch {
+						fieldValue.Set(reflect.Zero(fieldValue.Type()))
 					}
 					continue
 				}
@@ -525,17 +962,17 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 				// If the field is also a polyrelation field, then prefer the polyrelation.
 				// Otherwise stop processing this node.
 				// This is to allow relation and polyrelation fields to coexist, supporting deprecation for consumers
-				if pFieldType, ok := polyrelationFields[args[1]]; ok && fieldValue.Type() != pFieldType {
+				if pFieldType, ok := plan.polyrelationFields[field.name]; ok && fieldValue.Type() != pFieldType {
 					continue
 				}
 
-				err = unmarshalNodeMaybeChoice(&m, relationship.Data, annotation, choiceMapping, included)
+				err = unmarshalNodeMaybeChoice(&m, relationship.Data, annotation, choiceMapping, state, pointer+"/data")
 				if err != nil {
 					er = err
 					break
 				}
 
-				if strings.HasPrefix(fieldType.Type.Name(), "NullableRelationship[") {
+				if field.isNullableRelationship {
 					fieldValue.Set(reflect.MakeMapWithSize(fieldValue.Type(), 1))
 					fieldValue.SetMapIndex(reflect.ValueOf(true), m)
 				} else {
@@ -563,7 +1000,7 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 					unmarshaledMeta := make(Meta)
 					if meta, ok := t["meta"].(map[string]interface{}); ok {
 						for metaK, metaV := range meta {
-							unmarshaledMeta[metaK] = metaV
+							unmarshaledMeta[metaK] = normalizeNumbers(metaV)
 						}
 					}
 
@@ -582,22 +1019,107 @@ func unmarshalNode(data *Node, model reflect.Value, included *map[string]*Node)
 			}
 
 			assign(fieldValue, reflect.ValueOf(links))
+		} else if annotation == annotationMeta {
+			if data.Meta == nil {
+				continue
+			}
+
+			// The whole meta object
+			if field.name == "" {
+				value, err := unmarshalMeta(*data.Meta, field.structField.Type)
+				if err != nil {
+					er = state.report(newUnmarshalError(loc.member("meta"), loc.fieldPath(field), field.structField.Type, err))
+					if er != nil {
+						break
+					}
+					continue
+				}
+
+				assign(fieldValue, value)
+				continue
+			}
+
+			member := (*data.Meta)[field.name]
+			if member == nil {
+				continue
+			}
+
+			metaLoc := loc.metaValue(field)
+			value, err := unmarshalAttribute(member, field, fieldValue, state, metaLoc)
+			if err != nil {
+				er = state.report(newUnmarshalError(metaLoc.pointer, metaLoc.field, field.structField.Type, err))
+				if er != nil {
+					break
+				}
+				continue
+			}
+
+			assign(fieldValue, value)
 		} else {
 			er = fmt.Errorf(unsupportedStructTagMsg, annotation)
 		}
 	}
 
+	if er == nil {
+		er = plan.err
+	}
+
+	if state != nil && (state.opts.report != nil || state.opts.disallowUnknownMembers) {
+		attributes, relationships := mapKeys(data.Attributes), mapKeys(data.Relationships)
+
+		state.reportIgnored(attributes, plan.attributes, loc.attribute)
+		state.reportIgnored(relationships, plan.relationships, loc.relationship)
+
+		if er == nil {
+			er = state.reportUnknownMembers(attributes, plan.attributes, loc.attribute)
+		}
+
+		if er == nil {
+			er = state.reportUnknownMembers(relationships, plan.relationships, loc.relationship)
+		}
+	}
+
 	return er
 }
 
-func fullNode(n *Node, included *map[string]*Node) *Node {
-	includedKey := fmt.Sprintf("%s,%s", n.Type, n.ID)
+// unmarshalMeta decodes the meta object of a resource into a new value of
+// type t, e.g. a Meta or a struct with json tags, as encoding/json would. A
+// pointer to the new value is returned.
+func unmarshalMeta(meta Meta, t reflect.Type) (reflect.Value, error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return reflect.Value{}, err
+	}
 
-	if included != nil && (*included)[includedKey] != nil {
-		return (*included)[includedKey]
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(data, v.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("%w: %v", ErrInvalidType, err)
+	}
+	return v, nil
+}
+
+func mapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// fullNode returns the resource of the "included" array identified by the
+// type and id of n, along with its JSON Pointer. If no such resource was
+// included, n itself and the given pointer are returned.
+func fullNode(n *Node, state *unmarshalState, pointer string) (*Node, string) {
+	includedKey := nodeKey(n)
+
+	if state != nil && state.included[includedKey] != nil {
+		return state.included[includedKey], state.includedPointers[includedKey]
 	}
 
-	return n
+	return n, pointer
 }
 
 // assign will take the value specified and assign it to the field; if
@@ -639,63 +1161,85 @@ func assignValue(field, value reflect.Value) {
 
 func unmarshalAttribute(
 	attribute interface{},
-	args []string,
-	structField reflect.StructField,
-	fieldValue reflect.Value) (value reflect.Value, err error) {
+	field *fieldPlan,
+	fieldValue reflect.Value,
+	state *unmarshalState,
+	loc location) (value reflect.Value, err error) {
 	value = reflect.ValueOf(attribute)
-	fieldType := structField.Type
+	fieldType := field.structField.Type
 
 	// Handle NullableAttr[T]
-	if strings.HasPrefix(fieldValue.Type().Name(), "NullableAttr[") {
-		value, err = handleNullable(attribute, args, structField, fieldValue)
+	if field.isNullableAttr && fieldValue.Type() == fieldType {
+		value, err = handleNullable(attribute, field, fieldValue, state, loc)
 		return
 	}
 
-	// Handle field of type []string
-	if fieldValue.Type() == reflect.TypeOf([]string{}) {
-		value, err = handleStringSlice(attribute)
+	// Past a NullableAttr, the value is of the type it wraps
+	if field.isNullableAttr {
+		fieldType = fieldValue.Type()
+	}
+
+	// Merge the object into the nested struct the model holds
+	if state.opts.patch && field.merge && field.nested && !field.isSlice {
+		var merged bool
+		if value, merged, err = mergeStruct(attribute, fieldValue, state, loc); merged {
+			return
+		}
+	}
+
+	// Handle field of a type with a registered codec
+	if codec, t := findCodec(state.opts.codecs, fieldValue.Type()); codec != nil && codec.decode != nil {
+		value, err = decodeValue(codec, t, attribute)
 		return
 	}
 
 	// Handle field of type time.Time
-	if fieldValue.Type() == reflect.TypeOf(time.Time{}) ||
-		fieldValue.Type() == reflect.TypeOf(new(time.Time)) {
-		value, err = handleTime(attribute, args, fieldValue)
+	if field.isTime || field.isTimePtr {
+		value, err = handleTime(attribute, field, fieldValue)
+		return
+	}
+
+	// Handle field of a type that unmarshals itself, e.g. with UnmarshalJSON
+	if !field.nested && isUnmarshaler(fieldValue.Type()) {
+		value, err = unmarshalValue(attribute, fieldValue.Type())
 		return
 	}
 
 	if fieldValue.Type().Kind() == reflect.Interface {
-		return reflect.ValueOf(attribute), nil
+		return reflect.ValueOf(normalizeNumbers(attribute)), nil
 	}
 
+	attribute = coerceAttribute(attribute, fieldValue.Type(), state, loc)
+	value = reflect.ValueOf(attribute)
+
 	// Handle field of type struct
 	if fieldValue.Type().Kind() == reflect.Struct {
-		value, err = handleStruct(attribute, fieldValue)
+		value, err = handleStruct(attribute, fieldValue, state, loc)
 		return
 	}
 
-	// Handle field containing slice of structs
-	if fieldValue.Type().Kind() == reflect.Slice &&
-		reflect.TypeOf(fieldValue.Interface()).Elem().Kind() == reflect.Struct {
-		value, err = handleStructSlice(attribute, fieldValue)
+	// Handle field of type slice, array or map, element by element
+	switch fieldValue.Kind() {
+	case reflect.Slice:
+		value, err = handleSlice(attribute, field, fieldValue, state, loc)
 		return
-	}
-
-	if fieldValue.Type().Kind() == reflect.Slice &&
-		reflect.TypeOf(fieldValue.Interface()).Elem().Kind() == reflect.Ptr {
-		value, err = handleStructPointerSlice(attribute, args, fieldValue)
+	case reflect.Array:
+		value, err = handleArray(attribute, field, fieldValue, state, loc)
+		return
+	case reflect.Map:
+		value, err = handleMap(attribute, field, fieldValue, state, loc)
 		return
 	}
 
-	// JSON value was a float (numeric)
-	if value.Kind() == reflect.Float64 {
+	// JSON value was a number
+	if _, ok := attribute.(json.Number); ok || value.Kind() == reflect.Float64 {
 		value, err = handleNumeric(attribute, fieldType, fieldValue)
 		return
 	}
 
 	// Field was a Pointer type
 	if fieldValue.Kind() == reflect.Ptr {
-		value, err = handlePointer(attribute, args, fieldType, fieldValue, structField)
+		value, err = handlePointer(attribute, fieldType, fieldValue, field.structField, state, loc)
 		return
 	}
 
@@ -705,24 +1249,190 @@ func unmarshalAttribute(
 		return
 	}
 
+	value = reflect.ValueOf(normalizeNumbers(attribute))
 	return
 }
 
-func handleStringSlice(attribute interface{}) (reflect.Value, error) {
-	v := reflect.ValueOf(attribute)
-	values := make([]string, v.Len())
-	for i := 0; i < v.Len(); i++ {
-		values[i] = v.Index(i).Interface().(string)
+// handleSlice unmarshals the JSON array attribute into a new slice of the
+// type of fieldValue, element by element. A []byte is unmarshaled from a base64
+// string instead, as encoding/json does.
+func handleSlice(
+	attribute interface{},
+	field *fieldPlan,
+	fieldValue reflect.Value,
+	state *unmarshalState,
+	loc location) (reflect.Value, error) {
+	t := fieldValue.Type()
+
+	if t.Elem().Kind() == reflect.Uint8 {
+		s, ok := attribute.(string)
+		if !ok {
+			return reflect.Value{}, ErrInvalidType
+		}
+
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		return reflect.ValueOf(b).Convert(t), nil
+	}
+
+	elements, ok := attribute.([]interface{})
+	if !ok {
+		return reflect.Value{}, ErrInvalidType
+	}
+
+	elementField := field.elementPlan(t.Elem())
+	slice := reflect.MakeSlice(t, len(elements), len(elements))
+	for i, element := range elements {
+		value, err := unmarshalElement(element, elementField, t.Elem(), state, loc.index(i))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		slice.Index(i).Set(value)
+	}
+
+	return slice, nil
+}
+
+// handleArray unmarshals the JSON array attribute into a new array of the
+// type of fieldValue, element by element. As with encoding/json, extra
+// elements are ignored and missing ones are left zero.
+func handleArray(
+	attribute interface{},
+	field *fieldPlan,
+	fieldValue reflect.Value,
+	state *unmarshalState,
+	loc location) (reflect.Value, error) {
+	t := fieldValue.Type()
+
+	elements, ok := attribute.([]interface{})
+	if !ok {
+		return reflect.Value{}, ErrInvalidType
 	}
 
-	return reflect.ValueOf(values), nil
+	elementField := field.elementPlan(t.Elem())
+	array := reflect.New(t).Elem()
+	for i := 0; i < len(elements) && i < t.Len(); i++ {
+		value, err := unmarshalElement(elements[i], elementField, t.Elem(), state, loc.index(i))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		array.Index(i).Set(value)
+	}
+
+	return array, nil
+}
+
+// handleMap unmarshals the JSON object attribute into a new map of the type
+// of fieldValue, member by member. Keys are converted as encoding/json does.
+func handleMap(
+	attribute interface{},
+	field *fieldPlan,
+	fieldValue reflect.Value,
+	state *unmarshalState,
+	loc location) (reflect.Value, error) {
+	t := fieldValue.Type()
+
+	members, ok := attribute.(map[string]interface{})
+	if !ok {
+		return reflect.Value{}, ErrInvalidType
+	}
+
+	keys := make([]string, 0, len(members))
+	for k := range members {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	elementField := field.elementPlan(t.Elem())
+	m := reflect.MakeMapWithSize(t, len(members))
+	for _, k := range keys {
+		elementLoc := loc.key(k)
+
+		key, err := mapKey(k, t.Key())
+		if err != nil {
+			return reflect.Value{}, newUnmarshalError(elementLoc.pointer, elementLoc.field, t.Key(), err)
+		}
+
+		value, err := unmarshalElement(members[k], elementField, t.Elem(), state, elementLoc)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		m.SetMapIndex(key, value)
+	}
+
+	return m, nil
+}
+
+// unmarshalElement unmarshals an element of a slice, array or map attribute
+// into a new value of type t. A null element is left zero.
+func unmarshalElement(
+	element interface{},
+	field *fieldPlan,
+	t reflect.Type,
+	state *unmarshalState,
+	loc location) (reflect.Value, error) {
+	slot := reflect.New(t).Elem()
+	if element == nil {
+		return slot, nil
+	}
+
+	valueType := t
+	if valueType.Kind() == reflect.Ptr {
+		valueType = valueType.Elem()
+	}
+
+	value, err := unmarshalAttribute(element, field, reflect.Zero(valueType), state, loc)
+	if err != nil {
+		return reflect.Value{}, newUnmarshalError(loc.pointer, loc.field, t, err)
+	}
+
+	assign(slot, value)
+	return slot, nil
+}
+
+// mapKey converts the member name k into a map key of type t, which may
+// implement encoding.TextUnmarshaler or be of a string or integer kind.
+func mapKey(k string, t reflect.Type) (reflect.Value, error) {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		key := reflect.New(t)
+		if err := key.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(k)); err != nil {
+			return reflect.Value{}, err
+		}
+		return key.Elem(), nil
+	}
+
+	key := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		key.SetString(k)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(k, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, numberError(err)
+		}
+		key.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(k, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, numberError(err)
+		}
+		key.SetUint(u)
+	default:
+		return reflect.Value{}, ErrInvalidType
+	}
+
+	return key, nil
 }
 
 func handleNullable(
 	attribute interface{},
-	args []string,
-	structField reflect.StructField,
-	fieldValue reflect.Value) (reflect.Value, error) {
+	field *fieldPlan,
+	fieldValue reflect.Value,
+	state *unmarshalState,
+	loc location) (reflect.Value, error) {
 
 	if a, ok := attribute.(string); ok && a == "null" {
 		return reflect.ValueOf(nil), nil
@@ -731,37 +1441,32 @@ func handleNullable(
 	innerType := fieldValue.Type().Elem()
 	zeroValue := reflect.Zero(innerType)
 
-	attrVal, err := unmarshalAttribute(attribute, args, structField, zeroValue)
+	attrVal, err := unmarshalAttribute(attribute, field, zeroValue, state, loc)
 	if err != nil {
 		return reflect.ValueOf(nil), err
 	}
 
+	// Numbers and types that unmarshal themselves are handed back as pointers
+	if attrVal.Kind() == reflect.Ptr && innerType.Kind() != reflect.Ptr {
+		attrVal = attrVal.Elem()
+	}
+
 	fieldValue.Set(reflect.MakeMapWithSize(fieldValue.Type(), 1))
 	fieldValue.SetMapIndex(reflect.ValueOf(true), attrVal)
 
 	return fieldValue, nil
 }
 
-func handleTime(attribute interface{}, args []string, fieldValue reflect.Value) (reflect.Value, error) {
-	var isISO8601, isRFC3339 bool
+func handleTime(attribute interface{}, field *fieldPlan, fieldValue reflect.Value) (reflect.Value, error) {
 	v := reflect.ValueOf(attribute)
 
-	if len(args) > 2 {
-		for _, arg := range args[2:] {
-			if arg == annotationISO8601 {
-				isISO8601 = true
-			} else if arg == annotationRFC3339 {
-				isRFC3339 = true
-			}
-		}
-	}
-
-	if isISO8601 {
-		if v.Kind() != reflect.String {
+	if field.iso8601 {
+		s, ok := attribute.(string)
+		if !ok {
 			return reflect.ValueOf(time.Now()), ErrInvalidISO8601
 		}
 
-		t, err := time.Parse(iso8601TimeFormat, v.Interface().(string))
+		t, err := time.Parse(iso8601TimeFormat, s)
 		if err != nil {
 			return reflect.ValueOf(time.Now()), ErrInvalidISO8601
 		}
@@ -773,12 +1478,13 @@ func handleTime(attribute interface{}, args []string, fieldValue reflect.Value)
 		return reflect.ValueOf(t), nil
 	}
 
-	if isRFC3339 {
-		if v.Kind() != reflect.String {
+	if field.rfc3339 {
+		s, ok := attribute.(string)
+		if !ok {
 			return reflect.ValueOf(time.Now()), ErrInvalidRFC3339
 		}
 
-		t, err := time.Parse(time.RFC3339, v.Interface().(string))
+		t, err := time.Parse(time.RFC3339, s)
 		if err != nil {
 			return reflect.ValueOf(time.Now()), ErrInvalidRFC3339
 		}
@@ -792,7 +1498,17 @@ func handleTime(attribute interface{}, args []string, fieldValue reflect.Value)
 
 	var at int64
 
-	if v.Kind() == reflect.Float64 {
+	if n, ok := attribute.(json.Number); ok {
+		i, err := n.Int64()
+		if err != nil {
+			f, err := n.Float64()
+			if err != nil {
+				return reflect.ValueOf(time.Now()), ErrInvalidTime
+			}
+			i = int64(f)
+		}
+		at = i
+	} else if v.Kind() == reflect.Float64 {
 		at = int64(v.Interface().(float64))
 	} else if v.Kind() == reflect.Int {
 		at = v.Int()
@@ -809,55 +1525,49 @@ func handleNumeric(
 	attribute interface{},
 	fieldType reflect.Type,
 	fieldValue reflect.Value) (reflect.Value, error) {
-	v := reflect.ValueOf(attribute)
-	floatValue := v.Interface().(float64)
+	var number json.Number
+	switch a := attribute.(type) {
+	case json.Number:
+		number = a
+	case float64:
+		number = json.Number(strconv.FormatFloat(a, 'g', -1, 64))
+	default:
+		return reflect.Value{}, ErrInvalidType
+	}
 
-	var kind reflect.Kind
 	if fieldValue.Kind() == reflect.Ptr {
-		kind = fieldType.Elem().Kind()
-	} else {
-		kind = fieldType.Kind()
+		fieldType = fieldType.Elem()
 	}
 
 	var numericValue reflect.Value
 
-	switch kind {
-	case reflect.Int:
-		n := int(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Int8:
-		n := int8(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Int16:
-		n := int16(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Int32:
-		n := int32(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Int64:
-		n := int64(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Uint:
-		n := uint(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Uint8:
-		n := uint8(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Uint16:
-		n := uint16(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Uint32:
-		n := uint32(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Uint64:
-		n := uint64(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Float32:
-		n := float32(floatValue)
-		numericValue = reflect.ValueOf(&n)
-	case reflect.Float64:
-		n := floatValue
-		numericValue = reflect.ValueOf(&n)
+	switch fieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := parseInt(string(number), fieldType.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		numericValue = reflect.New(fieldType)
+		numericValue.Elem().SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := parseUint(string(number), fieldType.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		numericValue = reflect.New(fieldType)
+		numericValue.Elem().SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(string(number), fieldType.Bits())
+		if err != nil {
+			return reflect.Value{}, numberError(err)
+		}
+		numericValue = reflect.New(fieldType)
+		numericValue.Elem().SetFloat(f)
+	case reflect.String:
+		if fieldType != jsonNumberType {
+			return reflect.Value{}, ErrUnknownFieldNumberType
+		}
+		numericValue = reflect.ValueOf(&number)
 	default:
 		return reflect.Value{}, ErrUnknownFieldNumberType
 	}
@@ -865,12 +1575,128 @@ func handleNumeric(
 	return numericValue, nil
 }
 
+// parseInt parses the JSON number s into a signed integer of the given bit
+// size. Numbers written with a fraction or an exponent are accepted as long as
+// their value is an integer that can be represented exactly.
+func parseInt(s string, bits int) (int64, error) {
+	i, err := strconv.ParseInt(s, 10, bits)
+	if err == nil {
+		return i, nil
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, ErrNumberOverflow
+	}
+
+	f, err := parseIntegralFloat(s)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := math.Ldexp(1, bits-1)
+	if f < -limit || f >= limit {
+		return 0, ErrNumberOverflow
+	}
+	if math.Abs(f) >= maxExactFloat {
+		return 0, ErrNumberPrecision
+	}
+
+	return int64(f), nil
+}
+
+// parseUint parses the JSON number s into an unsigned integer of the given
+// bit size, the same way parseInt does.
+func parseUint(s string, bits int) (uint64, error) {
+	u, err := strconv.ParseUint(s, 10, bits)
+	if err == nil {
+		return u, nil
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, ErrNumberOverflow
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil || errors.Is(err, strconv.ErrRange) {
+		// A negative integer
+		return 0, ErrNumberOverflow
+	}
+
+	f, err := parseIntegralFloat(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if f < 0 || f >= math.Ldexp(1, bits) {
+		return 0, ErrNumberOverflow
+	}
+	if f >= maxExactFloat {
+		return 0, ErrNumberPrecision
+	}
+
+	return uint64(f), nil
+}
+
+// isJSONNumber reports whether s is a number as defined by the JSON spec.
+func isJSONNumber(s string) bool {
+	if s == "" || (s[0] != '-' && (s[0] < '0' || s[0] > '9')) {
+		return false
+	}
+	return json.Valid([]byte(s))
+}
+
+// numericID returns the number the id s of a resource stands for, when
+// unmarshaled into a numeric field. On top of JSON numbers, ids with a plus
+// sign or leading zeros, such as "+5" or "007", are accepted.
+func numericID(s string) (json.Number, bool) {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	for len(s) > 1 && s[0] == '0' && s[1] >= '0' && s[1] <= '9' {
+		s = s[1:]
+	}
+
+	// The sign was taken off already
+	if s == "" || s[0] == '-' {
+		return "", false
+	}
+	n := sign + s
+	return json.Number(n), isJSONNumber(n)
+}
+
+// maxExactFloat is the float64 below which every integer can be represented
+// exactly. Integers written with a fraction or an exponent are only accepted
+// below it, since from there on the parsed float64 may have been rounded.
+const maxExactFloat = 1 << 53
+
+// parseIntegralFloat parses the JSON number s, written with a fraction or an
+// exponent, returning ErrNumberPrecision if its value is not an integer.
+func parseIntegralFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, numberError(err)
+	}
+	if f != math.Trunc(f) {
+		return 0, ErrNumberPrecision
+	}
+	return f, nil
+}
+
+// numberError converts an error returned by the strconv package into
+// ErrNumberOverflow for out of range numbers.
+func numberError(err error) error {
+	if errors.Is(err, strconv.ErrRange) {
+		return ErrNumberOverflow
+	}
+	return err
+}
+
 func handlePointer(
 	attribute interface{},
-	args []string,
 	fieldType reflect.Type,
 	fieldValue reflect.Value,
-	structField reflect.StructField) (reflect.Value, error) {
+	structField reflect.StructField,
+	state *unmarshalState,
+	loc location) (reflect.Value, error) {
 	t := fieldValue.Type()
 	var concreteVal reflect.Value
 
@@ -883,7 +1709,7 @@ func handlePointer(
 		concreteVal = reflect.ValueOf(&cVal)
 	case map[string]interface{}:
 		var err error
-		concreteVal, err = handleStruct(attribute, fieldValue)
+		concreteVal, err = handleStruct(attribute, fieldValue, state, loc)
 		if err != nil {
 			return reflect.Value{}, newErrUnsupportedPtrType(
 				reflect.ValueOf(attribute), fieldType, structField)
@@ -904,7 +1730,9 @@ func handlePointer(
 
 func handleStruct(
 	attribute interface{},
-	fieldValue reflect.Value) (reflect.Value, error) {
+	fieldValue reflect.Value,
+	state *unmarshalState,
+	loc location) (reflect.Value, error) {
 
 	data, err := json.Marshal(attribute)
 	if err != nil {
@@ -912,7 +1740,7 @@ func handleStruct(
 	}
 
 	node := new(Node)
-	if err := json.Unmarshal(data, &node.Attributes); err != nil {
+	if err := decodeJSON(bytes.NewReader(data), &node.Attributes); err != nil {
 		return reflect.Value{}, err
 	}
 
@@ -923,48 +1751,9 @@ func handleStruct(
 		model = reflect.New(fieldValue.Type())
 	}
 
-	if err := unmarshalNode(node, model, nil); err != nil {
+	if err := unmarshalNode(node, model, state, loc); err != nil {
 		return reflect.Value{}, err
 	}
 
 	return model, nil
 }
-
-func handleStructSlice(
-	attribute interface{},
-	fieldValue reflect.Value) (reflect.Value, error) {
-	models := reflect.New(fieldValue.Type()).Elem()
-	dataMap := reflect.ValueOf(attribute).Interface().([]interface{})
-	for _, data := range dataMap {
-		model := reflect.New(fieldValue.Type().Elem()).Elem()
-
-		value, err := handleStruct(data, model)
-
-		if err != nil {
-			continue
-		}
-
-		models = reflect.Append(models, reflect.Indirect(value))
-	}
-
-	return models, nil
-}
-
-func handleStructPointerSlice(
-	attribute interface{},
-	args []string,
-	fieldValue reflect.Value) (reflect.Value, error) {
-
-	dataMap := reflect.ValueOf(attribute).Interface().([]interface{})
-	models := reflect.New(fieldValue.Type()).Elem()
-	for _, data := range dataMap {
-		model := reflect.New(fieldValue.Type().Elem()).Elem()
-		value, err := handleStruct(data, model)
-		if err != nil {
-			continue
-		}
-
-		models = reflect.Append(models, value)
-	}
-	return models, nil
-}
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net/netip"
 	"reflect"
 	"sort"
 	"strconv"
@@ -198,12 +200,17 @@ func TestUnmarshalToStructWithPointerAttr_BadType_bool(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected error due to invalid type.")
 	}
-	if err.Error() != expectedErrorMessage {
-		t.Fatalf("Unexpected error message: %s", err.Error())
-	}
-	if _, ok := err.(ErrUnsupportedPtrType); !ok {
+	var ptrErr ErrUnsupportedPtrType
+	if !errors.As(err, &ptrErr) {
 		t.Fatalf("Unexpected error type: %s", reflect.TypeOf(err))
 	}
+	if ptrErr.Error() != expectedErrorMessage {
+		t.Fatalf("Unexpected error message: %s", ptrErr.Error())
+	}
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/attributes/name" {
+		t.Fatalf("Expected an UnmarshalError pointing at the name attribute, got %v", err)
+	}
 }
 
 func TestUnmarshalToStructWithPointerAttr_BadType_MapPtr(t *testing.T) {
@@ -218,12 +225,17 @@ func TestUnmarshalToStructWithPointerAttr_BadType_MapPtr(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected error due to invalid type.")
 	}
-	if err.Error() != expectedErrorMessage {
-		t.Fatalf("Unexpected error message: %s", err.Error())
-	}
-	if _, ok := err.(ErrUnsupportedPtrType); !ok {
+	var ptrErr ErrUnsupportedPtrType
+	if !errors.As(err, &ptrErr) {
 		t.Fatalf("Unexpected error type: %s", reflect.TypeOf(err))
 	}
+	if ptrErr.Error() != expectedErrorMessage {
+		t.Fatalf("Unexpected error message: %s", ptrErr.Error())
+	}
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/attributes/name" {
+		t.Fatalf("Expected an UnmarshalError pointing at the name attribute, got %v", err)
+	}
 }
 
 func TestUnmarshalToStructWithPointerAttr_BadType_Struct(t *testing.T) {
@@ -239,12 +251,17 @@ func TestUnmarshalToStructWithPointerAttr_BadType_Struct(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected error due to invalid type.")
 	}
-	if err.Error() != expectedErrorMessage {
-		t.Fatalf("Unexpected error message: %s", err.Error())
-	}
-	if _, ok := err.(ErrUnsupportedPtrType); !ok {
+	var ptrErr ErrUnsupportedPtrType
+	if !errors.As(err, &ptrErr) {
 		t.Fatalf("Unexpected error type: %s", reflect.TypeOf(err))
 	}
+	if ptrErr.Error() != expectedErrorMessage {
+		t.Fatalf("Unexpected error message: %s", ptrErr.Error())
+	}
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/attributes/name" {
+		t.Fatalf("Expected an UnmarshalError pointing at the name attribute, got %v", err)
+	}
 }
 
 func TestUnmarshalToStructWithPointerAttr_BadType_IntSlice(t *testing.T) {
@@ -259,12 +276,17 @@ func TestUnmarshalToStructWithPointerAttr_BadType_IntSlice(t *testing.T) {
 	if err == nil {
 		t.Fatalf("Expected error due to invalid type.")
 	}
-	if err.Error() != expectedErrorMessage {
-		t.Fatalf("Unexpected error message: %s", err.Error())
-	}
-	if _, ok := err.(ErrUnsupportedPtrType); !ok {
+	var ptrErr ErrUnsupportedPtrType
+	if !errors.As(err, &ptrErr) {
 		t.Fatalf("Unexpected error type: %s", reflect.TypeOf(err))
 	}
+	if ptrErr.Error() != expectedErrorMessage {
+		t.Fatalf("Unexpected error message: %s", ptrErr.Error())
+	}
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/attributes/name" {
+		t.Fatalf("Expected an UnmarshalError pointing at the name attribute, got %v", err)
+	}
 }
 
 func TestStringPointerField(t *testing.T) {
@@ -546,16 +568,22 @@ func TestUnmarshalInvalidJSON_BadType(t *testing.T) {
 			out := new(ModelBadTypes)
 			in := map[string]interface{}{}
 			in[test.Field] = test.BadValue
-			expectedErrorMessage := test.Error.Error()
 
 			err := UnmarshalPayload(samplePayloadWithBadTypes(in), out)
 
 			if err == nil {
 				t.Fatalf("Expected error due to invalid type.")
 			}
-			if err.Error() != expectedErrorMessage {
+			if !errors.Is(err, test.Error) {
 				t.Fatalf("Unexpected error message: %s", err.Error())
 			}
+			var unmarshalErr *UnmarshalError
+			if !errors.As(err, &unmarshalErr) {
+				t.Fatalf("Unexpected error type: %s", reflect.TypeOf(err))
+			}
+			if e, a := "/data/attributes/"+test.Field, unmarshalErr.Pointer; e != a {
+				t.Fatalf("Was expecting pointer %q, got %q", e, a)
+			}
 		})
 	}
 }
@@ -573,6 +601,38 @@ func TestUnmarshalSetsID(t *testing.T) {
 	}
 }
 
+func TestUnmarshalPayload_numericIDForms(t *testing.T) {
+	for _, tc := range []struct {
+		id       string
+		expected uint64
+	}{
+		{"5", 5},
+		{"007", 7},
+		{"+5", 5},
+		{"+007", 7},
+		{"0", 0},
+		{"1e2", 100},
+	} {
+		in := strings.NewReader(fmt.Sprintf(`{"data": {"type": "posts", "id": %q}}`, tc.id))
+		out := new(Post)
+
+		if err := UnmarshalPayload(in, out); err != nil {
+			t.Fatalf("Unexpected error for id %q: %v", tc.id, err)
+		}
+		if out.ID != tc.expected {
+			t.Errorf("Expected id %q to be %d, got %d", tc.id, tc.expected, out.ID)
+		}
+	}
+
+	for _, id := range []string{"+", "-", "+-5", "--5", "++5", " 5", "5 ", "0x10", "Inf", "NaN", ".5"} {
+		in := strings.NewReader(fmt.Sprintf(`{"data": {"type": "posts", "id": %q}}`, id))
+
+		if err := UnmarshalPayload(in, new(Post)); !errors.Is(err, ErrBadJSONAPIID) {
+			t.Errorf("Expected ErrBadJSONAPIID for id %q, got %v", id, err)
+		}
+	}
+}
+
 func TestUnmarshal_nonNumericID(t *testing.T) {
 	data := samplePayloadWithoutIncluded()
 	data["data"].(map[string]interface{})["id"] = "non-numeric-id"
@@ -583,7 +643,7 @@ func TestUnmarshal_nonNumericID(t *testing.T) {
 	in := bytes.NewReader(payload)
 	out := new(Post)
 
-	if err := UnmarshalPayload(in, out); err != ErrBadJSONAPIID {
+	if err := UnmarshalPayload(in, out); !errors.Is(err, ErrBadJSONAPIID) {
 		t.Fatalf(
 			"Was expecting a `%s` error, got `%s`",
 			ErrBadJSONAPIID,
@@ -1511,7 +1571,7 @@ func TestUnmarshalCustomTypeAttributes_ErrInvalidType(t *testing.T) {
 		t.Fatal("Expected an error unmarshalling the payload due to type mismatch, got none")
 	}
 
-	if err != ErrInvalidType {
+	if !errors.Is(err, ErrInvalidType) {
 		t.Fatalf("Expected error to be %v, was %v", ErrInvalidType, err)
 	}
 }
@@ -2068,3 +2128,789 @@ func TestUnmarshalNestedStructPointerSlice(t *testing.T) {
 		t.Fatalf("Nested pointer struct not unmarshalled: Expected `19` but got `%d`", out.People[1].Age)
 	}
 }
+
+func TestUnmarshalPayload_collectErrors(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "companies",
+			"id": "1",
+			"attributes": {
+				"name": 5,
+				"founded-at": "yesterday",
+				"boss": {"firstname": "Jane", "age": "old"},
+				"teams": [{"name": "a"}, {"name": false}]
+			}
+		}
+	}`)
+	out := new(Company)
+
+	err := UnmarshalPayload(in, out, CollectErrors())
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected UnmarshalErrors, got %v", err)
+	}
+
+	expected := map[string]string{
+		"/data/attributes/name":         "Name",
+		"/data/attributes/founded-at":   "FoundedAt",
+		"/data/attributes/boss/age":     "Boss.Age",
+		"/data/attributes/teams/1/name": "Teams.Name",
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(expected), len(errs), errs)
+	}
+	for _, e := range errs {
+		field, ok := expected[e.Pointer]
+		if !ok {
+			t.Errorf("Unexpected error %v", e)
+			continue
+		}
+		if field != e.Field {
+			t.Errorf("Expected field %q for %q, got %q", field, e.Pointer, e.Field)
+		}
+	}
+
+	if out.Boss.Firstname != "Jane" {
+		t.Errorf("Expected valid members to be unmarshaled, got %+v", out.Boss)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := MarshalErrors(buf, errs.ErrorObjects()); err != nil {
+		t.Fatal(err)
+	}
+	var payload ErrorsPayload
+	if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Errors) != len(expected) {
+		t.Fatalf("Expected %d error objects, got %d", len(expected), len(payload.Errors))
+	}
+}
+
+func TestUnmarshalManyPayload_collectErrors(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": [
+			{"type": "posts", "id": "1", "attributes": {"title": 1}},
+			{"type": "comments", "id": "x"},
+			{"type": "posts", "id": "3", "relationships": {"comments": {"data": [{"type": "comments", "id": "1"}]}}}
+		],
+		"included": [
+			{"type": "comments", "id": "1", "attributes": {"body": true}}
+		]
+	}`)
+
+	_, err := UnmarshalManyPayload(in, reflect.TypeOf(new(Post)), CollectErrors())
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected UnmarshalErrors, got %v", err)
+	}
+
+	var pointers []string
+	for _, e := range errs {
+		pointers = append(pointers, e.Pointer)
+	}
+	expected := []string{
+		"/data/0/attributes/title",
+		"/data/1/type",
+		"/included/0/attributes/body",
+	}
+	if !reflect.DeepEqual(pointers, expected) {
+		t.Fatalf("Expected pointers %v, got %v", expected, pointers)
+	}
+	if !errors.Is(errs[2], ErrInvalidType) {
+		t.Fatalf("Expected %v to wrap %v", errs[2], ErrInvalidType)
+	}
+}
+
+func TestUnmarshalPayload_collectErrorsStopsOnBadTag(t *testing.T) {
+	err := UnmarshalPayload(samplePayload(), new(BadModel), CollectErrors())
+	if err != ErrBadJSONAPIStructTag {
+		t.Fatalf("Expected %v, got %v", ErrBadJSONAPIStructTag, err)
+	}
+}
+
+func TestUnmarshalPayload_disallowUnknownMembers(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "blogs",
+			"id": "1",
+			"attributes": {"title": "Title", "subtitle": "Subtitle"},
+			"relationships": {
+				"posts": {"data": []},
+				"owner": {"data": {"type": "users", "id": "1"}}
+			}
+		},
+		"included": [
+			{"type": "comments", "id": "1"},
+			{"type": "users", "id": "1"}
+		],
+		"extra": true
+	}`)
+
+	err := UnmarshalPayload(in, new(Blog), DisallowUnknownMembers(), CollectErrors())
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected UnmarshalErrors, got %v", err)
+	}
+
+	var pointers []string
+	for _, e := range errs {
+		pointers = append(pointers, e.Pointer)
+	}
+	expected := []string{
+		"/extra",
+		"/data/attributes/subtitle",
+		"/data/relationships/owner",
+		"/included/1/type",
+	}
+	if !reflect.DeepEqual(pointers, expected) {
+		t.Fatalf("Expected pointers %v, got %v", expected, pointers)
+	}
+	if !errors.Is(errs[2], ErrUnknownMember) {
+		t.Errorf("Expected %v to wrap %v", errs[2], ErrUnknownMember)
+	}
+	if !errors.Is(errs[3], ErrUnknownType) {
+		t.Errorf("Expected %v to wrap %v", errs[3], ErrUnknownType)
+	}
+	if status := errs[0].ErrorObject().Status; status != "400" {
+		t.Errorf("Expected status 400, got %s", status)
+	}
+}
+
+func TestUnmarshalPayload_disallowUnknownMembersStopsAtFirst(t *testing.T) {
+	in := strings.NewReader(`{"data": {"type": "blogs", "id": "1", "attributes": {"subtitle": "x"}}}`)
+
+	err := UnmarshalPayload(in, new(Blog), DisallowUnknownMembers())
+
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) {
+		t.Fatalf("Expected an *UnmarshalError, got %v", err)
+	}
+	if unmarshalErr.Pointer != "/data/attributes/subtitle" {
+		t.Fatalf("Unexpected pointer %q", unmarshalErr.Pointer)
+	}
+}
+
+func TestUnmarshalPayload_disallowUnknownMembersNested(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "companies",
+			"id": "1",
+			"attributes": {"boss": {"firstname": "Jane", "nickname": "J"}}
+		}
+	}`)
+
+	err := UnmarshalPayload(in, new(Company), DisallowUnknownMembers())
+
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) {
+		t.Fatalf("Expected an *UnmarshalError, got %v", err)
+	}
+	if unmarshalErr.Pointer != "/data/attributes/boss/nickname" {
+		t.Fatalf("Unexpected pointer %q", unmarshalErr.Pointer)
+	}
+}
+
+func TestUnmarshalPayload_disallowUnknownPolyrelationType(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "blogs",
+			"id": "1",
+			"relationships": {
+				"hero-media": {"data": {"type": "audio", "id": "1"}}
+			}
+		}
+	}`)
+
+	if err := UnmarshalPayload(in, new(BlogPostWithPoly)); err != nil {
+		t.Fatalf("Expected unknown choice types to be ignored by default, got %v", err)
+	}
+
+	in.Seek(0, io.SeekStart)
+	err := UnmarshalPayload(in, new(BlogPostWithPoly), DisallowUnknownMembers())
+	if !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("Expected %v, got %v", ErrUnknownType, err)
+	}
+
+	var unmarshalErr *UnmarshalError
+	if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != "/data/relationships/hero-media/data/type" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+}
+
+func TestUnmarshalManyPayload_disallowUnknownMembers(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": [
+			{"type": "posts", "id": "1", "relationships": {"comments": {"data": [{"type": "comments", "id": "1"}]}}}
+		],
+		"included": [
+			{"type": "comments", "id": "1", "attributes": {"body": "Hi"}}
+		],
+		"meta": {"total": 1}
+	}`)
+
+	posts, err := UnmarshalManyPayload(in, reflect.TypeOf(new(Post)), DisallowUnknownMembers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].(*Post).Comments[0].Body != "Hi" {
+		t.Fatalf("Unexpected result %+v", posts)
+	}
+}
+
+func TestUnmarshalPayload_losslessNumbers(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "numbers",
+			"id": "9007199254740993",
+			"attributes": {
+				"int8": -128,
+				"int64": 9223372036854775807,
+				"uint8": 2.55e2,
+				"uint64": 18446744073709551615,
+				"float32": 1.5,
+				"number": 123456789012345678901234567890,
+				"any": {"n": 1}
+			}
+		}
+	}`)
+	out := new(Numbers)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.ID != 9007199254740993 {
+		t.Errorf("Expected ID %d, got %d", int64(9007199254740993), out.ID)
+	}
+	if out.Int8 != math.MinInt8 {
+		t.Errorf("Expected int8 %d, got %d", math.MinInt8, out.Int8)
+	}
+	if out.Int64 != math.MaxInt64 {
+		t.Errorf("Expected int64 %d, got %d", int64(math.MaxInt64), out.Int64)
+	}
+	if out.Uint8 == nil || *out.Uint8 != math.MaxUint8 {
+		t.Errorf("Expected uint8 %d, got %v", math.MaxUint8, out.Uint8)
+	}
+	if out.Uint64 != math.MaxUint64 {
+		t.Errorf("Expected uint64 %d, got %d", uint64(math.MaxUint64), out.Uint64)
+	}
+	if out.Float32 != 1.5 {
+		t.Errorf("Expected float32 1.5, got %v", out.Float32)
+	}
+	if out.Number != "123456789012345678901234567890" {
+		t.Errorf("Expected number to be kept as is, got %v", out.Number)
+	}
+	if !reflect.DeepEqual(out.Any, map[string]interface{}{"n": float64(1)}) {
+		t.Errorf("Expected interface{} attributes to hold float64 numbers, got %#v", out.Any)
+	}
+}
+
+func TestUnmarshalPayload_numberErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		id      string
+		attrs   string
+		pointer string
+		cause   error
+	}{
+		{"int8 overflow", "1", `{"int8": 300}`, "/data/attributes/int8", ErrNumberOverflow},
+		{"int8 underflow", "1", `{"int8": -129}`, "/data/attributes/int8", ErrNumberOverflow},
+		{"int64 overflow", "1", `{"int64": 9223372036854775808}`, "/data/attributes/int64", ErrNumberOverflow},
+		{"negative uint", "1", `{"uint8": -1}`, "/data/attributes/uint8", ErrNumberOverflow},
+		{"uint64 overflow", "1", `{"uint64": 1e20}`, "/data/attributes/uint64", ErrNumberOverflow},
+		{"float32 overflow", "1", `{"float32": 1e39}`, "/data/attributes/float32", ErrNumberOverflow},
+		{"fraction", "1", `{"int64": 1.5}`, "/data/attributes/int64", ErrNumberPrecision},
+		{"inexact exponent", "1", `{"int64": 9.007199254740993e15}`, "/data/attributes/int64", ErrNumberPrecision},
+		{"id overflow", "9223372036854775808", `{}`, "/data/id", ErrNumberOverflow},
+		{"id fraction", "1.5", `{}`, "/data/id", ErrNumberPrecision},
+		{"id not a number", "0x10", `{}`, "/data/id", ErrBadJSONAPIID},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			in := strings.NewReader(fmt.Sprintf(
+				`{"data": {"type": "numbers", "id": %q, "attributes": %s}}`, tc.id, tc.attrs))
+
+			err := UnmarshalPayload(in, new(Numbers))
+			if !errors.Is(err, tc.cause) {
+				t.Fatalf("Expected %v, got %v", tc.cause, err)
+			}
+
+			var unmarshalErr *UnmarshalError
+			if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != tc.pointer {
+				t.Fatalf("Expected an *UnmarshalError at %q, got %v", tc.pointer, err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalPayload_unmarshalerAttributes(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "gadgets",
+			"id": "1",
+			"attributes": {
+				"color": "red",
+				"color-ptr": "green",
+				"price": "1999",
+				"addr": "2001:db8::1",
+				"nullable-color": "green"
+			}
+		}
+	}`)
+	out := new(Gadget)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Color != Red {
+		t.Errorf("Expected color %v, got %v", Red, out.Color)
+	}
+	if out.ColorPtr == nil || *out.ColorPtr != Green {
+		t.Errorf("Expected color pointer to %v, got %v", Green, out.ColorPtr)
+	}
+	if out.Price.Cents != 1999 {
+		t.Errorf("Expected price 1999, got %d", out.Price.Cents)
+	}
+	if out.Addr != netip.MustParseAddr("2001:db8::1") {
+		t.Errorf("Expected addr 2001:db8::1, got %v", out.Addr)
+	}
+	if color, err := out.NullableColor.Get(); err != nil || color != Green {
+		t.Errorf("Expected nullable color %v, got %v (%v)", Green, color, err)
+	}
+}
+
+func TestUnmarshalPayload_unmarshalerErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		attrs   string
+		pointer string
+	}{
+		{"UnmarshalText error", `{"color": "blue"}`, "/data/attributes/color"},
+		{"text of a non-string", `{"color": true}`, "/data/attributes/color"},
+		{"UnmarshalJSON error", `{"price": 19.99}`, "/data/attributes/price"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			in := strings.NewReader(fmt.Sprintf(
+				`{"data": {"type": "gadgets", "id": "1", "attributes": %s}}`, tc.attrs))
+
+			err := UnmarshalPayload(in, new(Gadget))
+
+			var unmarshalErr *UnmarshalError
+			if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != tc.pointer {
+				t.Fatalf("Expected an *UnmarshalError at %q, got %v", tc.pointer, err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalPayload_numericTextUnmarshaler(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "gadgets",
+			"id": "1",
+			"attributes": {
+				"color": 2,
+				"color-ptr": 1,
+				"nullable-color": "red"
+			}
+		}
+	}`)
+	out := new(Gadget)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Color != Green {
+		t.Errorf("Expected color %v, got %v", Green, out.Color)
+	}
+	if out.ColorPtr == nil || *out.ColorPtr != Red {
+		t.Errorf("Expected color pointer to %v, got %v", Red, out.ColorPtr)
+	}
+	if color, err := out.NullableColor.Get(); err != nil || color != Red {
+		t.Errorf("Expected nullable color %v, got %v (%v)", Red, color, err)
+	}
+}
+
+func TestUnmarshalPayload_collectionAttributes(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "collections",
+			"id": "1",
+			"attributes": {
+				"ints": [1, 2],
+				"floats": [1.5],
+				"bools": [true, false],
+				"int-ptrs": [1, null],
+				"triple": [1, 2, 3, 4],
+				"bytes": "aGk=",
+				"counts": {"a": 1},
+				"tags": {"go": ["fast"]},
+				"by-year": {"2020": "covid"},
+				"bosses": {"ceo": {"firstname": "Jane", "hired-at": "2020-01-02T03:04:05Z"}},
+				"dates": ["2020-01-02T03:04:05Z"],
+				"colors": ["red", "green"],
+				"grid": [[1], [2, 3]],
+				"anything": [1, "a", {"b": 2}]
+			}
+		}
+	}`)
+	out := new(Collections)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	one := 1
+	hiredAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	expected := &Collections{
+		ID:       "1",
+		Ints:     []int{1, 2},
+		Floats:   []float64{1.5},
+		Bools:    []bool{true, false},
+		IntPtrs:  []*int{&one, nil},
+		Triple:   [3]uint8{1, 2, 3},
+		Bytes:    []byte("hi"),
+		Counts:   map[string]int{"a": 1},
+		Tags:     map[string][]string{"go": {"fast"}},
+		ByYear:   map[int]string{2020: "covid"},
+		Bosses:   map[string]*Employee{"ceo": {Firstname: "Jane", HiredAt: &hiredAt}},
+		Dates:    []time.Time{hiredAt},
+		Colors:   []Color{Red, Green},
+		Grid:     [][]int{{1}, {2, 3}},
+		Anything: []interface{}{float64(1), "a", map[string]interface{}{"b": float64(2)}},
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, out)
+	}
+}
+
+func TestUnmarshalPayload_collectionAttributeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		attrs   string
+		pointer string
+		cause   error
+	}{
+		{"element type", `{"ints": [1, "2"]}`, "/data/attributes/ints/1", ErrInvalidType},
+		{"element overflow", `{"triple": [1, 256]}`, "/data/attributes/triple/1", ErrNumberOverflow},
+		{"not an array", `{"ints": {"a": 1}}`, "/data/attributes/ints", ErrInvalidType},
+		{"map value", `{"counts": {"a/b": true}}`, "/data/attributes/counts/a~1b", ErrInvalidType},
+		{"map key", `{"by-year": {"soon": "x"}}`, "/data/attributes/by-year/soon", nil},
+		{"nested element", `{"tags": {"go": ["fast", true]}}`, "/data/attributes/tags/go/1", ErrInvalidType},
+		{"nested struct", `{"bosses": {"ceo": {"age": "old"}}}`, "/data/attributes/bosses/ceo/age", ErrInvalidType},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			in := strings.NewReader(fmt.Sprintf(
+				`{"data": {"type": "collections", "id": "1", "attributes": %s}}`, tc.attrs))
+
+			err := UnmarshalPayload(in, new(Collections))
+
+			var unmarshalErr *UnmarshalError
+			if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != tc.pointer {
+				t.Fatalf("Expected an *UnmarshalError at %q, got %v", tc.pointer, err)
+			}
+			if tc.cause != nil && !errors.Is(err, tc.cause) {
+				t.Fatalf("Expected %v, got %v", tc.cause, err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalPayload_embeddedStructs(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "widgets",
+			"id": "1",
+			"attributes": {
+				"name": "Sprocket",
+				"created_at": "2020-01-02T03:04:05Z",
+				"updated_at": "2021-01-02T03:04:05Z"
+			},
+			"relationships": {
+				"owner": {"data": {"type": "comments", "id": "2"}}
+			},
+			"links": {"self": "http://example.com/widgets/1"}
+		}
+	}`)
+	out := new(Widget)
+
+	if err := UnmarshalPayload(in, out, DisallowUnknownMembers()); err != nil {
+		t.Fatal(err)
+	}
+
+	createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	updatedAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	expected := &Widget{
+		BaseModel: BaseModel{
+			ID:         "1",
+			Timestamps: Timestamps{CreatedAt: createdAt, UpdatedAt: &updatedAt},
+			Links:      Links{"self": "http://example.com/widgets/1"},
+		},
+		Name:  "Sprocket",
+		Owner: &Comment{ID: 2},
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, out)
+	}
+}
+
+func TestUnmarshalPayload_embeddedStructPointers(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "gizmos",
+			"id": "1",
+			"attributes": {
+				"created_at": "yesterday",
+				"updated_at": "2021-01-02T03:04:05Z"
+			}
+		}
+	}`)
+	out := new(Gizmo)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.ID != "1" || out.CreatedAt != "yesterday" {
+		t.Fatalf("Unexpected gizmo %+v", out)
+	}
+	if out.BaseModel == nil || out.UpdatedAt == nil || out.UpdatedAt.Year() != 2021 {
+		t.Fatalf("Expected the embedded BaseModel to be allocated, got %+v", out.BaseModel)
+	}
+	if out.BaseModel.ID != "" || !out.Timestamps.CreatedAt.IsZero() {
+		t.Fatalf("Expected shadowed fields to be left alone, got %+v", out.BaseModel)
+	}
+}
+
+func TestUnmarshalPayload_embeddedStructConflicts(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "banners",
+			"id": "1",
+			"attributes": {"label": "Sale", "lang": "en"}
+		}
+	}`)
+	out := new(Banner)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Heading.Label != "" || out.Caption.Label != "" || out.Lang != "en" {
+		t.Fatalf("Unexpected banner %+v", out)
+	}
+
+	in = strings.NewReader(`{"data": {"type": "banners", "id": "1", "attributes": {"label": "Sale"}}}`)
+	if err := UnmarshalPayload(in, new(Banner), DisallowUnknownMembers()); !errors.Is(err, ErrUnknownMember) {
+		t.Fatalf("Expected %v, got %v", ErrUnknownMember, err)
+	}
+}
+
+func TestUnmarshalPayload_includedCycles(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "novels",
+			"id": "1",
+			"attributes": {"title": "Dune"},
+			"relationships": {
+				"author": {"data": {"type": "authors", "id": "1"}},
+				"sequel": {"data": {"type": "novels", "id": "2"}}
+			}
+		},
+		"included": [
+			{
+				"type": "authors",
+				"id": "1",
+				"attributes": {"name": "Frank Herbert"},
+				"relationships": {
+					"novels": {"data": [{"type": "novels", "id": "1"}, {"type": "novels", "id": "2"}]}
+				}
+			},
+			{
+				"type": "novels",
+				"id": "2",
+				"attributes": {"title": "Dune Messiah"},
+				"relationships": {
+					"author": {"data": {"type": "authors", "id": "1"}},
+					"sequel": {"data": {"type": "novels", "id": "2"}}
+				}
+			}
+		]
+	}`)
+	novel := new(Novel)
+
+	if err := UnmarshalPayload(in, novel); err != nil {
+		t.Fatal(err)
+	}
+
+	author := novel.Author
+	if author == nil || author.Name != "Frank Herbert" || len(author.Novels) != 2 {
+		t.Fatalf("Unexpected author %+v", author)
+	}
+	if author.Novels[0] != novel {
+		t.Error("Expected the author's first novel to be the primary data")
+	}
+
+	sequel := author.Novels[1]
+	if novel.Sequel != sequel || sequel.Title != "Dune Messiah" {
+		t.Errorf("Expected both references to the sequel to share an instance, got %p and %p", novel.Sequel, sequel)
+	}
+	if sequel.Author != author || sequel.Sequel != sequel {
+		t.Error("Expected the sequel's relationships to resolve to the same instances")
+	}
+}
+
+func TestUnmarshalManyPayload_sharedResources(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": [
+			{
+				"type": "novels",
+				"id": "1",
+				"relationships": {
+					"author": {"data": {"type": "authors", "id": "1"}},
+					"sequel": {"data": {"type": "novels", "id": "2"}}
+				}
+			},
+			{
+				"type": "novels",
+				"id": "2",
+				"attributes": {"title": "Dune Messiah"},
+				"relationships": {"author": {"data": {"type": "authors", "id": "1"}}}
+			}
+		],
+		"included": [
+			{"type": "authors", "id": "1", "attributes": {"name": "Frank Herbert"}}
+		]
+	}`)
+
+	out, err := UnmarshalManyPayload(in, reflect.TypeOf(new(Novel)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, second := out[0].(*Novel), out[1].(*Novel)
+	if first.Author == nil || first.Author != second.Author {
+		t.Errorf("Expected both novels to share their author, got %p and %p", first.Author, second.Author)
+	}
+	if first.Sequel != second {
+		t.Error("Expected the sequel to be the second novel of the primary data")
+	}
+}
+
+func TestUnmarshalPayload_metaFields(t *testing.T) {
+	in := strings.NewReader(`{
+		"data": {
+			"type": "articles",
+			"id": "1",
+			"attributes": {"title": "Hello"},
+			"meta": {
+				"total_views": 9007199254740993,
+				"published_at": "2020-01-02T03:04:05Z",
+				"rating": 4.5,
+				"color": "green",
+				"unknown": true
+			}
+		}
+	}`)
+	out := new(Article)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if out.Title != "Hello" || out.TotalViews != 9007199254740993 || out.Color != Green {
+		t.Fatalf("Unexpected article %+v", out)
+	}
+	if !out.PublishedAt.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("Unexpected published_at %v", out.PublishedAt)
+	}
+	if rating, err := out.Rating.Get(); err != nil || rating != 4.5 {
+		t.Fatalf("Expected a rating of 4.5, got %v", out.Rating)
+	}
+}
+
+func TestUnmarshalPayload_wholeMeta(t *testing.T) {
+	payload := `{"data": {"type": "articles", "id": "1", "meta": {"views": 3, "source": "feed"}}}`
+
+	stats := new(ArticleWithStats)
+	if err := UnmarshalPayload(strings.NewReader(payload), stats); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(stats.Stats, &ArticleStats{Views: 3, Source: "feed"}) {
+		t.Fatalf("Unexpected stats %+v", stats.Stats)
+	}
+
+	meta := new(ArticleWithMeta)
+	if err := UnmarshalPayload(strings.NewReader(payload), meta); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(meta.Meta, Meta{"views": float64(3), "source": "feed"}) {
+		t.Fatalf("Unexpected meta %+v", meta.Meta)
+	}
+}
+
+func TestUnmarshalPayload_metaErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		model   interface{}
+		meta    string
+		pointer string
+	}{
+		{"member", new(Article), `{"total_views": "many"}`, "/data/meta/total_views"},
+		{"time", new(Article), `{"published_at": "yesterday"}`, "/data/meta/published_at"},
+		{"whole", new(ArticleWithStats), `{"views": "many"}`, "/data/meta"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			in := strings.NewReader(fmt.Sprintf(`{"data": {"type": "articles", "id": "1", "meta": %s}}`, tc.meta))
+
+			err := UnmarshalPayload(in, tc.model)
+
+			var unmarshalErr *UnmarshalError
+			if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != tc.pointer {
+				t.Fatalf("Expected an *UnmarshalError at %q, got %v", tc.pointer, err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalPayload_nullableNumbers(t *testing.T) {
+	type withNullableNumbers struct {
+		ID    string                `jsonapi:"primary,numbers"`
+		Int   NullableAttr[int]     `jsonapi:"attr,int,omitempty"`
+		Float NullableAttr[float64] `jsonapi:"attr,float,omitempty"`
+	}
+
+	in := strings.NewReader(`{"data": {"type": "numbers", "id": "1", "attributes": {"int": 3, "float": 1.5}}}`)
+	out := new(withNullableNumbers)
+
+	if err := UnmarshalPayload(in, out); err != nil {
+		t.Fatal(err)
+	}
+
+	if i, err := out.Int.Get(); err != nil || i != 3 {
+		t.Errorf("Expected int 3, got %v", out.Int)
+	}
+	if f, err := out.Float.Get(); err != nil || f != 1.5 {
+		t.Errorf("Expected float 1.5, got %v", out.Float)
+	}
+}
+
+func BenchmarkUnmarshalManyPayload(b *testing.B) {
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, benchmarkBlogs(500)); err != nil {
+		b.Fatal(err)
+	}
+	in := out.Bytes()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := UnmarshalManyPayload(bytes.NewReader(in), reflect.TypeOf(new(Blog))); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
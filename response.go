@@ -1,13 +1,15 @@
 package jsonapi
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
 )
 
@@ -63,19 +65,21 @@ var (
 //				 http.Error(w, err.Error(), http.StatusInternalServerError)
 //			 }
 //		 }
-func MarshalPayload(w io.Writer, models interface{}) error {
-	payload, err := Marshal(models)
+func MarshalPayload(w io.Writer, models interface{}, opts ...MarshalOption) error {
+	payload, err := Marshal(models, opts...)
 	if err != nil {
 		return err
 	}
 
-	return json.NewEncoder(w).Encode(payload)
+	return writePayload(w, payload, newMarshalOptions(opts), false)
 }
 
 // Marshal does the same as MarshalPayload except it just returns the payload
 // and doesn't write out results. Useful if you use your own JSON rendering
 // library.
-func Marshal(models interface{}) (Payloader, error) {
+func Marshal(models interface{}, opts ...MarshalOption) (Payloader, error) {
+	state := newMarshalState(newMarshalOptions(opts))
+
 	switch vals := reflect.ValueOf(models); vals.Kind() {
 	case reflect.Slice:
 		m, err := convertToSliceInterface(&models)
@@ -83,7 +87,12 @@ func Marshal(models interface{}) (Payloader, error) {
 			return nil, err
 		}
 
-		payload, err := marshalMany(m)
+		// The include paths are checked even if there is no model to marshal
+		if err := state.checkInclude(vals.Type().Elem()); err != nil {
+			return nil, err
+		}
+
+		payload, err := marshalMany(m, state)
 		if err != nil {
 			return nil, err
 		}
@@ -100,13 +109,27 @@ func Marshal(models interface{}) (Payloader, error) {
 			payload.Meta = metableModels.JSONAPIMeta()
 		}
 
+		if err := state.opts.topLevel(&payload.Links, &payload.Meta, &payload.JSONAPI); err != nil {
+			return nil, err
+		}
+
 		return payload, nil
 	case reflect.Ptr:
 		// Check that the pointer was to a struct
 		if reflect.Indirect(vals).Kind() != reflect.Struct {
 			return nil, ErrUnexpectedType
 		}
-		return marshalOne(models)
+
+		payload, err := marshalOne(models, state)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := state.opts.topLevel(&payload.Links, &payload.Meta, &payload.JSONAPI); err != nil {
+			return nil, err
+		}
+
+		return payload, nil
 	default:
 		return nil, ErrUnexpectedType
 	}
@@ -119,29 +142,71 @@ func Marshal(models interface{}) (Payloader, error) {
 //
 // models interface{} should be either a struct pointer or a slice of struct
 // pointers.
-func MarshalPayloadWithoutIncluded(w io.Writer, model interface{}) error {
-	payload, err := Marshal(model)
+func MarshalPayloadWithoutIncluded(w io.Writer, model interface{}, opts ...MarshalOption) error {
+	// The included resources are not written, so they are not limited either
+	opts = append(opts, func(o *marshalOptions) {
+		o.limits.MaxIncluded = 0
+	})
+
+	payload, err := Marshal(model, opts...)
 	if err != nil {
 		return err
 	}
 	payload.clearIncluded()
 
-	return json.NewEncoder(w).Encode(payload)
+	return writePayload(w, payload, newMarshalOptions(opts), false)
+}
+
+// marshalState holds the state of a single call to one of the marshal
+// functions, threaded through every node that is visited.
+type marshalState struct {
+	opts *marshalOptions
+	// include is the include tree of the resource being visited, nil when
+	// every relationship is sideloaded.
+	include includeTree
+	// checked holds the model types the include paths were checked against.
+	checked map[reflect.Type]bool
+	// visiting maps each resource being visited to its node, so that the
+	// cycles of the model graph are only followed once.
+	visiting map[resourceKey]*Node
+}
+
+// resourceKey identifies a resource by its type and id.
+type resourceKey struct {
+	typ, id string
+}
+
+// nodeKey returns the key of the resource n.
+func nodeKey(n *Node) resourceKey {
+	return resourceKey{typ: n.Type, id: n.ID}
+}
+
+func newMarshalState(opts *marshalOptions) *marshalState {
+	return &marshalState{opts: opts, include: opts.include, visiting: map[resourceKey]*Node{}}
 }
 
 // marshalOne does the same as MarshalOnePayload except it just returns the
 // payload and doesn't write out results. Useful is you use your JSON rendering
 // library.
-func marshalOne(model interface{}) (*OnePayload, error) {
+func marshalOne(model interface{}, state *marshalState) (*OnePayload, error) {
+	if err := state.checkInclude(reflect.TypeOf(model)); err != nil {
+		return nil, err
+	}
+
 	included := make(map[string]*Node)
 
-	rootNode, err := visitModelNode(model, &included, true)
+	rootNode, err := visitModelNode(model, &included, true, state)
 	if err != nil {
 		return nil, err
 	}
+	excludePrimary(included, rootNode)
 	payload := &OnePayload{Data: rootNode}
 
-	payload.Included = nodeMapValues(&included)
+	payload.Included = includedNodes([]*Node{rootNode}, included, state.opts)
+
+	if err := state.opts.limits.checkPayload([]*Node{rootNode}, payload.Included, false); err != nil {
+		return nil, err
+	}
 
 	return payload, nil
 }
@@ -149,20 +214,29 @@ func marshalOne(model interface{}) (*OnePayload, error) {
 // marshalMany does the same as MarshalManyPayload except it just returns the
 // payload and doesn't write out results. Useful is you use your JSON rendering
 // library.
-func marshalMany(models []interface{}) (*ManyPayload, error) {
+func marshalMany(models []interface{}, state *marshalState) (*ManyPayload, error) {
 	payload := &ManyPayload{
 		Data: []*Node{},
 	}
 	included := map[string]*Node{}
 
 	for _, model := range models {
-		node, err := visitModelNode(model, &included, true)
+		if err := state.checkInclude(reflect.TypeOf(model)); err != nil {
+			return nil, err
+		}
+
+		node, err := visitModelNode(model, &included, true, state)
 		if err != nil {
 			return nil, err
 		}
 		payload.Data = append(payload.Data, node)
 	}
-	payload.Included = nodeMapValues(&included)
+	excludePrimary(included, payload.Data...)
+	payload.Included = includedNodes(payload.Data, included, state.opts)
+
+	if err := state.opts.limits.checkPayload(payload.Data, payload.Included, true); err != nil {
+		return nil, err
+	}
 
 	return payload, nil
 }
@@ -182,38 +256,30 @@ func marshalMany(models []interface{}) (*ManyPayload, error) {
 // this method is intended for.
 //
 // model interface{} should be a pointer to a struct.
-func MarshalOnePayloadEmbedded(w io.Writer, model interface{}) error {
-	rootNode, err := visitModelNode(model, nil, false)
+func MarshalOnePayloadEmbedded(w io.Writer, model interface{}, opts ...MarshalOption) error {
+	o := newMarshalOptions(opts)
+	rootNode, err := visitModelNode(model, nil, false, newMarshalState(o))
 	if err != nil {
 		return err
 	}
 
 	payload := &OnePayload{Data: rootNode}
+	if err := o.topLevel(&payload.Links, &payload.Meta, &payload.JSONAPI); err != nil {
+		return err
+	}
 
-	return json.NewEncoder(w).Encode(payload)
+	return writePayload(w, payload, o, false)
 }
 
 // selectChoiceTypeStructField returns the first non-nil struct pointer field in the
 // specified struct value that has a jsonapi type field defined within it.
 // An error is returned if there are no fields matching that definition.
 func selectChoiceTypeStructField(structValue reflect.Value) (reflect.Value, error) {
-	for i := 0; i < structValue.NumField(); i++ {
+	for _, i := range choicePlanFor(structValue.Type()).fields {
 		choiceFieldValue := structValue.Field(i)
-		choiceTypeField := choiceFieldValue.Type()
-
-		// Must be a pointer
-		if choiceTypeField.Kind() != reflect.Ptr {
-			continue
-		}
 
 		// Must not be nil
-		if choiceFieldValue.IsNil() {
-			continue
-		}
-
-		subtype := choiceTypeField.Elem()
-		_, err := jsonapiTypeOfModel(subtype)
-		if err == nil {
+		if !choiceFieldValue.IsNil() {
 			return choiceFieldValue, nil
 		}
 	}
@@ -224,37 +290,41 @@ func selectChoiceTypeStructField(structValue reflect.Value) (reflect.Value, erro
 // hasJSONAPIAnnotations returns true if any of the fields of a struct type t
 // has a jsonapi annotation. This function will panic if t is not a struct type.
 func hasJSONAPIAnnotations(t reflect.Type) bool {
+	return hasJSONAPIAnnotationsVisited(t, map[reflect.Type]bool{})
+}
+
+func hasJSONAPIAnnotationsVisited(t reflect.Type, visited map[reflect.Type]bool) bool {
+	visited[t] = true
+
 	for i := 0; i < t.NumField(); i++ {
-		tag := t.Field(i).Tag.Get(annotationJSONAPI)
+		field := t.Field(i)
+		tag := field.Tag.Get(annotationJSONAPI)
 		if tag != "" {
 			return true
 		}
+
+		// Look for annotations promoted from embedded structs
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && fieldType.Kind() == reflect.Struct && !visited[fieldType] &&
+			hasJSONAPIAnnotationsVisited(fieldType, visited) {
+			return true
+		}
 	}
 	return false
 }
 
-func visitModelNodeAttribute(args []string, node *Node, fieldValue reflect.Value) error {
-	var omitEmpty, iso8601, rfc3339 bool
-
-	if len(args) > 2 {
-		for _, arg := range args[2:] {
-			switch arg {
-			case annotationOmitEmpty:
-				omitEmpty = true
-			case annotationISO8601:
-				iso8601 = true
-			case annotationRFC3339:
-				rfc3339 = true
-			}
-		}
-	}
+func visitModelNodeAttribute(field *fieldPlan, node *Node, fieldValue reflect.Value, state *marshalState) error {
+	omitEmpty := field.omitEmpty
 
 	if node.Attributes == nil {
 		node.Attributes = make(map[string]interface{})
 	}
 
 	// Handle NullableAttr[T]
-	if strings.HasPrefix(fieldValue.Type().Name(), "NullableAttr[") {
+	if field.isNullableAttr {
 		// handle unspecified
 		if fieldValue.IsNil() {
 			return nil
@@ -262,7 +332,7 @@ func visitModelNodeAttribute(args []string, node *Node, fieldValue reflect.Value
 
 		// handle null
 		if fieldValue.MapIndex(reflect.ValueOf(false)).IsValid() {
-			node.Attributes[args[1]] = json.RawMessage("null")
+			node.Attributes[field.name] = json.RawMessage("null")
 			return nil
 		} else {
 
@@ -271,28 +341,36 @@ func visitModelNodeAttribute(args []string, node *Node, fieldValue reflect.Value
 		}
 	}
 
-	if fieldValue.Type() == reflect.TypeOf(time.Time{}) {
+	// Attribute of a type with a registered codec
+	if codec, t := findCodec(state.opts.codecs, fieldValue.Type()); codec != nil && codec.encode != nil {
+		if omitEmpty && fieldValue.IsZero() {
+			return nil
+		}
+
+		value, err := encodeValue(codec, t, fieldValue)
+		if err != nil {
+			return fmt.Errorf("failed to marshal attribute %q: %w", field.name, err)
+		}
+		node.Attributes[field.name] = value
+		return nil
+	}
+
+	if field.isTime {
 		t := fieldValue.Interface().(time.Time)
 
 		if t.IsZero() {
 			return nil
 		}
 
-		if iso8601 {
-			node.Attributes[args[1]] = t.UTC().Format(iso8601TimeFormat)
-		} else if rfc3339 {
-			node.Attributes[args[1]] = t.UTC().Format(time.RFC3339)
-		} else {
-			node.Attributes[args[1]] = t.Unix()
-		}
-	} else if fieldValue.Type() == reflect.TypeOf(new(time.Time)) {
+		node.Attributes[field.name] = formatTime(field, t)
+	} else if field.isTimePtr {
 		// A time pointer may be nil
 		if fieldValue.IsNil() {
 			if omitEmpty {
 				return nil
 			}
 
-			node.Attributes[args[1]] = nil
+			node.Attributes[field.name] = nil
 		} else {
 			tm := fieldValue.Interface().(*time.Time)
 
@@ -300,13 +378,7 @@ func visitModelNodeAttribute(args []string, node *Node, fieldValue reflect.Value
 				return nil
 			}
 
-			if iso8601 {
-				node.Attributes[args[1]] = tm.UTC().Format(iso8601TimeFormat)
-			} else if rfc3339 {
-				node.Attributes[args[1]] = tm.UTC().Format(time.RFC3339)
-			} else {
-				node.Attributes[args[1]] = tm.Unix()
-			}
+			node.Attributes[field.name] = formatTime(field, *tm)
 		}
 	} else {
 		// Dealing with a fieldValue that is not a time
@@ -317,6 +389,16 @@ func visitModelNodeAttribute(args []string, node *Node, fieldValue reflect.Value
 			return nil
 		}
 
+		// Attribute of a type that marshals itself, e.g. with MarshalJSON
+		if !field.nested && isMarshaler(fieldValue.Type()) {
+			value, err := marshalValue(fieldValue)
+			if err != nil {
+				return fmt.Errorf("failed to marshal attribute %q: %w", field.name, err)
+			}
+			node.Attributes[field.name] = value
+			return nil
+		}
+
 		isStruct := fieldValue.Type().Kind() == reflect.Struct
 		isPointerToStruct := fieldValue.Type().Kind() == reflect.Pointer && fieldValue.Elem().Kind() == reflect.Struct
 		isSliceOfStruct := fieldValue.Type().Kind() == reflect.Slice && fieldValue.Type().Elem().Kind() == reflect.Struct
@@ -327,83 +409,190 @@ func visitModelNodeAttribute(args []string, node *Node, fieldValue reflect.Value
 				return nil
 			}
 
-			var t reflect.Type
-			if isSliceOfStruct {
-				t = fieldValue.Type().Elem()
-			} else {
-				t = fieldValue.Type().Elem().Elem()
-			}
-
 			// This check is to maintain backwards compatibility with `json` annotated
 			// nested structs, which should fall through to "primitive" handling below
-			if hasJSONAPIAnnotations(t) {
+			if field.nested {
 				// Nested slice of object attributes
-				manyNested, err := visitModelNodeRelationships(fieldValue, nil, false)
+				manyNested, err := visitModelNodeRelationships(fieldValue, field.name, true, nil, false, state)
 				if err != nil {
-					return fmt.Errorf("failed to marshal slice of nested attribute %q: %w", args[1], err)
+					return fmt.Errorf("failed to marshal slice of nested attribute %q: %w", field.name, err)
 				}
 				nestedNodes := make([]any, len(manyNested.Data))
 				for i, n := range manyNested.Data {
 					nestedNodes[i] = n.Attributes
 				}
-				node.Attributes[args[1]] = nestedNodes
+				node.Attributes[field.name] = nestedNodes
 				return nil
 			}
 		} else if isStruct || isPointerToStruct {
-			var t reflect.Type
-			if isStruct {
-				t = fieldValue.Type()
-			} else {
-				t = fieldValue.Type().Elem()
-			}
-
 			// This check is to maintain backwards compatibility with `json` annotated
 			// nested structs, which should fall through to "primitive" handling below
-			if hasJSONAPIAnnotations(t) {
+			if field.nested {
 				// Nested object attribute
-				nested, err := visitModelNode(fieldValue.Interface(), nil, false)
+				nested, err := visitModelNode(fieldValue.Interface(), nil, false, state)
 				if err != nil {
-					return fmt.Errorf("failed to marshal nested attribute %q: %w", args[1], err)
+					return fmt.Errorf("failed to marshal nested attribute %q: %w", field.name, err)
 				}
-				node.Attributes[args[1]] = nested.Attributes
+				node.Attributes[field.name] = nested.Attributes
+				return nil
+			}
+		}
+
+		// Slice, array or map attribute, visited element by element
+		if kind := fieldValue.Kind(); kind == reflect.Slice || kind == reflect.Array || kind == reflect.Map {
+			if omitEmpty && fieldValue.Len() == 0 {
 				return nil
 			}
+
+			value, err := visitAttributeValue(field, fieldValue, state)
+			if err != nil {
+				return fmt.Errorf("failed to marshal attribute %q: %w", field.name, err)
+			}
+			node.Attributes[field.name] = value
+			return nil
 		}
 
 		// Primitive attribute
 		strAttr, ok := fieldValue.Interface().(string)
 		if ok {
-			node.Attributes[args[1]] = strAttr
+			node.Attributes[field.name] = strAttr
 		} else {
-			node.Attributes[args[1]] = fieldValue.Interface()
+			node.Attributes[field.name] = fieldValue.Interface()
 		}
 	}
 
 	return nil
 }
 
-func visitModelNodeRelation(model any, annotation string, args []string, node *Node, fieldValue reflect.Value, included *map[string]*Node, sideload bool) error {
-	var omitEmpty bool
+// visitAttributeValue returns the value v, an element of the slice, array or
+// map attribute compiled into field or that attribute itself, in the form it
+// is to be encoded into the attributes of a node. Collections are visited
+// element by element, so that times, nested structs and types with a codec or
+// a marshaler are encoded the same way as they are for a single attribute.
+func visitAttributeValue(field *fieldPlan, v reflect.Value, state *marshalState) (interface{}, error) {
+	if codec, t := findCodec(state.opts.codecs, v.Type()); codec != nil && codec.encode != nil {
+		return encodeValue(codec, t, v)
+	}
 
-	//add support for 'omitempty' struct tag for marshaling as absent
-	if len(args) > 2 {
-		omitEmpty = args[2] == annotationOmitEmpty
+	t := v.Type()
+	switch {
+	case t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return visitAttributeValue(field, v.Elem(), state)
+	case t == timeType:
+		return formatTime(field, v.Interface().(time.Time)), nil
+	case t.Kind() == reflect.Struct && hasJSONAPIAnnotations(t):
+		node, err := visitModelNode(v.Interface(), nil, false, state)
+		if err != nil {
+			return nil, err
+		}
+		return node.Attributes, nil
+	case isMarshaler(t):
+		return marshalValue(v)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		// Left to encoding/json, which encodes it as a base64 string
+		return v.Interface(), nil
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if t.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+
+		elements := make([]interface{}, v.Len())
+		for i := range elements {
+			element, err := visitAttributeValue(field, v.Index(i), state)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return elements, nil
+	case t.Kind() == reflect.Map:
+		if v.IsNil() {
+			return nil, nil
+		}
+
+		members := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKeyName(iter.Key())
+			if err != nil {
+				return nil, err
+			}
+
+			member, err := visitAttributeValue(field, iter.Value(), state)
+			if err != nil {
+				return nil, err
+			}
+			members[key] = member
+		}
+		return members, nil
+	default:
+		return v.Interface(), nil
+	}
+}
+
+// formatTime formats t as configured for the time attribute compiled into
+// field: as an ISO8601 or RFC3339 string, or else as a unix timestamp.
+func formatTime(field *fieldPlan, t time.Time) interface{} {
+	if field.iso8601 {
+		return t.UTC().Format(iso8601TimeFormat)
+	} else if field.rfc3339 {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return t.Unix()
+}
+
+// mapKeyName returns the member name of the map key k, as encoding/json
+// would.
+func mapKeyName(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		b, err := tm.MarshalText()
+		return string(b), err
 	}
 
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+
+	return "", fmt.Errorf("unsupported map key type %v", k.Type())
+}
+
+func visitModelNodeRelation(model any, field *fieldPlan, node *Node, fieldValue reflect.Value, included *map[string]*Node, sideload bool, state *marshalState) error {
+	annotation := field.annotation
+
+	//add support for 'omitempty' struct tag for marshaling as absent
+	omitEmpty := field.omitEmpty
+
 	if node.Relationships == nil {
 		node.Relationships = make(map[string]interface{})
 	}
 
+	if field.isToOne || field.isToMany {
+		return visitRelationshipValue(model, field, node, fieldValue, included, sideload, state)
+	}
+
 	// Handle NullableRelationship[T]
-	if strings.HasPrefix(fieldValue.Type().Name(), "NullableRelationship[") {
+	if field.isNullableRelationship {
 
 		if fieldValue.MapIndex(reflect.ValueOf(false)).IsValid() {
 			innerTypeIsSlice := fieldValue.MapIndex(reflect.ValueOf(false)).Type().Kind() == reflect.Slice
 			// handle explicit null
 			if innerTypeIsSlice {
-				node.Relationships[args[1]] = json.RawMessage("[]")
+				node.Relationships[field.name] = json.RawMessage("[]")
 			} else {
-				node.Relationships[args[1]] = json.RawMessage("{\"data\":null}")
+				node.Relationships[field.name] = json.RawMessage("{\"data\":null}")
 			}
 			return nil
 		} else if fieldValue.MapIndex(reflect.ValueOf(true)).IsValid() {
@@ -419,6 +608,16 @@ func visitModelNodeRelation(model any, annotation string, args []string, node *N
 		return nil
 	}
 
+	follow := state.follows(field.name, sideload)
+	if !follow {
+		if state.opts.offPath == OffPathLinksOnly {
+			visitRelationshipLinks(model, field, node, nil, nil)
+			return nil
+		}
+		// Related resources off the include paths are linked, not sideloaded
+		sideload = false
+	}
+
 	if annotation == annotationPolyRelation {
 		// for polyrelation, we'll snoop out the actual relation model
 		// through the choice type value by choosing the first non-nil
@@ -478,20 +677,23 @@ func visitModelNodeRelation(model any, annotation string, args []string, node *N
 
 	var relLinks *Links
 	if linkableModel, ok := model.(RelationshipLinkable); ok {
-		relLinks = linkableModel.JSONAPIRelationshipLinks(args[1])
+		relLinks = linkableModel.JSONAPIRelationshipLinks(field.name)
 	}
 
 	var relMeta *Meta
 	if metableModel, ok := model.(RelationshipMetable); ok {
-		relMeta = metableModel.JSONAPIRelationshipMeta(args[1])
+		relMeta = metableModel.JSONAPIRelationshipMeta(field.name)
 	}
 
 	if isSlice {
 		// to-many relationship
 		relationship, err := visitModelNodeRelationships(
 			fieldValue,
+			field.name,
+			follow,
 			included,
 			sideload,
+			state,
 		)
 		if err != nil {
 			return err
@@ -506,27 +708,30 @@ func visitModelNodeRelation(model any, annotation string, args []string, node *N
 				shallowNodes = append(shallowNodes, toShallowNode(n))
 			}
 
-			node.Relationships[args[1]] = &RelationshipManyNode{
+			node.Relationships[field.name] = &RelationshipManyNode{
 				Data:  shallowNodes,
 				Links: relationship.Links,
 				Meta:  relationship.Meta,
 			}
 		} else {
-			node.Relationships[args[1]] = relationship
+			node.Relationships[field.name] = relationship
 		}
 	} else {
 		// to-one relationships
 
 		// Handle null relationship case
 		if fieldValue.IsNil() {
-			node.Relationships[args[1]] = &RelationshipOneNode{Data: nil}
+			node.Relationships[field.name] = &RelationshipOneNode{Data: nil}
 			return nil
 		}
 
-		relationship, err := visitModelNode(
+		relationship, err := visitRelatedModel(
 			fieldValue.Interface(),
+			field.name,
+			follow,
 			included,
 			sideload,
+			state,
 		)
 
 		if err != nil {
@@ -535,13 +740,13 @@ func visitModelNodeRelation(model any, annotation string, args []string, node *N
 
 		if sideload {
 			appendIncluded(included, relationship)
-			node.Relationships[args[1]] = &RelationshipOneNode{
+			node.Relationships[field.name] = &RelationshipOneNode{
 				Data:  toShallowNode(relationship),
 				Links: relLinks,
 				Meta:  relMeta,
 			}
 		} else {
-			node.Relationships[args[1]] = &RelationshipOneNode{
+			node.Relationships[field.name] = &RelationshipOneNode{
 				Data:  relationship,
 				Links: relLinks,
 				Meta:  relMeta,
@@ -552,12 +757,11 @@ func visitModelNodeRelation(model any, annotation string, args []string, node *N
 }
 
 func visitModelNode(model interface{}, included *map[string]*Node,
-	sideload bool) (*Node, error) {
+	sideload bool, state *marshalState) (*Node, error) {
 	node := new(Node)
 
 	var er error
 	var modelValue reflect.Value
-	var modelType reflect.Type
 	value := reflect.ValueOf(model)
 
 	if value.Type().Kind() == reflect.Pointer {
@@ -565,96 +769,75 @@ func visitModelNode(model interface{}, included *map[string]*Node,
 			return nil, nil
 		}
 		modelValue = value.Elem()
-		modelType = value.Type().Elem()
 	} else {
 		modelValue = value
-		modelType = value.Type()
 	}
 
-	for i := 0; i < modelValue.NumField(); i++ {
-		fieldValue := modelValue.Field(i)
-		structField := modelValue.Type().Field(i)
-		tag := structField.Tag.Get(annotationJSONAPI)
-		if tag == "" {
-			continue
-		}
+	plan := typePlanFor(modelValue.Type())
 
-		fieldType := modelType.Field(i)
+	// A resource reached again while it is being visited, through a cycle of
+	// the model graph, is only identified. Along include paths, which are
+	// finite, the cycles are followed as the paths say.
+	if plan.primary != nil && (!sideload || state.include == nil) {
+		if v, ok := fieldByIndex(modelValue, plan.primary.index); ok {
+			id, err := formatID(plan.primary.kind, reflect.Indirect(v))
+			if err != nil {
+				return nil, err
+			}
 
-		args := strings.Split(tag, annotationSeparator)
+			if id != "" {
+				key := resourceKey{typ: plan.primary.name, id: id}
+				if visiting, ok := state.visiting[key]; ok {
+					if sideload {
+						// Sideloaded, the node is complete once its visit is
+						return visiting, nil
+					}
+					return &Node{Type: visiting.Type, ID: visiting.ID}, nil
+				}
 
-		if len(args) < 1 {
-			er = ErrBadJSONAPIStructTag
-			break
+				node.Type, node.ID = plan.primary.name, id
+				state.visiting[key] = node
+				defer delete(state.visiting, key)
+			}
 		}
+	}
 
-		annotation := args[0]
-
-		if (annotation == annotationClientID && len(args) != 1) ||
-			(annotation != annotationClientID && len(args) < 2) {
-			er = ErrBadJSONAPIStructTag
-			break
+	for _, field := range plan.fields {
+		fieldValue, ok := fieldByIndex(modelValue, field.index)
+		if !ok || !state.opts.allowsField(plan, field) {
+			continue
 		}
+		annotation := field.annotation
 
 		if annotation == annotationPrimary {
-			v := fieldValue
-
-			// Deal with PTRS
-			var kind reflect.Kind
-			if fieldValue.Kind() == reflect.Ptr {
-				kind = fieldType.Type.Elem().Kind()
-				v = reflect.Indirect(fieldValue)
-			} else {
-				kind = fieldType.Type.Kind()
-			}
-
-			// Handle allowed types
-			switch kind {
-			case reflect.String:
-				node.ID = v.Interface().(string)
-			case reflect.Int:
-				node.ID = strconv.FormatInt(int64(v.Interface().(int)), 10)
-			case reflect.Int8:
-				node.ID = strconv.FormatInt(int64(v.Interface().(int8)), 10)
-			case reflect.Int16:
-				node.ID = strconv.FormatInt(int64(v.Interface().(int16)), 10)
-			case reflect.Int32:
-				node.ID = strconv.FormatInt(int64(v.Interface().(int32)), 10)
-			case reflect.Int64:
-				node.ID = strconv.FormatInt(v.Interface().(int64), 10)
-			case reflect.Uint:
-				node.ID = strconv.FormatUint(uint64(v.Interface().(uint)), 10)
-			case reflect.Uint8:
-				node.ID = strconv.FormatUint(uint64(v.Interface().(uint8)), 10)
-			case reflect.Uint16:
-				node.ID = strconv.FormatUint(uint64(v.Interface().(uint16)), 10)
-			case reflect.Uint32:
-				node.ID = strconv.FormatUint(uint64(v.Interface().(uint32)), 10)
-			case reflect.Uint64:
-				node.ID = strconv.FormatUint(v.Interface().(uint64), 10)
-			default:
-				// We had a JSON float (numeric), but our field was not one of the
-				// allowed numeric types
-				er = ErrBadJSONAPIID
+			if field == plan.primary && node.Type != "" {
+				// Already identified above
+				continue
 			}
 
+			node.ID, er = formatID(field.kind, reflect.Indirect(fieldValue))
 			if er != nil {
 				break
 			}
 
-			node.Type = args[1]
+			node.Type = field.name
 		} else if annotation == annotationClientID {
 			clientID := fieldValue.String()
 			if clientID != "" {
 				node.ClientID = clientID
 			}
 		} else if annotation == annotationAttribute {
-			er = visitModelNodeAttribute(args, node, fieldValue)
+			er = visitModelNodeAttribute(field, node, fieldValue, state)
 			if er != nil {
 				break
 			}
 		} else if annotation == annotationRelation || annotation == annotationPolyRelation {
-			er = visitModelNodeRelation(model, annotation, args, node, fieldValue, included, sideload)
+			er = visitModelNodeRelation(model, field, node, fieldValue, included, sideload, state)
+			if er != nil {
+				break
+			}
+		} else if annotation == annotationMeta {
+			er = visitModelNodeMeta(field, node, fieldValue, state)
 			if er != nil {
 				break
 			}
@@ -667,6 +850,10 @@ func visitModelNode(model interface{}, included *map[string]*Node,
 		}
 	}
 
+	if er == nil {
+		er = plan.err
+	}
+
 	if er != nil {
 		return nil, er
 	}
@@ -680,12 +867,95 @@ func visitModelNode(model interface{}, included *map[string]*Node,
 	}
 
 	if metableModel, ok := model.(Metable); ok {
-		node.Meta = metableModel.JSONAPIMeta()
+		if meta := metableModel.JSONAPIMeta(); node.Meta == nil {
+			node.Meta = meta
+		} else if meta != nil {
+			// Members returned by the Metable take precedence over meta fields
+			for k, v := range *meta {
+				(*node.Meta)[k] = v
+			}
+		}
 	}
 
 	return node, nil
 }
 
+// formatID formats v, the value of a primary field of the given kind, as a
+// resource id.
+func formatID(kind reflect.Kind, v reflect.Value) (string, error) {
+	// Handle allowed types
+	switch kind {
+	case reflect.String:
+		return v.Interface().(string), nil
+	case reflect.Int:
+		return strconv.FormatInt(int64(v.Interface().(int)), 10), nil
+	case reflect.Int8:
+		return strconv.FormatInt(int64(v.Interface().(int8)), 10), nil
+	case reflect.Int16:
+		return strconv.FormatInt(int64(v.Interface().(int16)), 10), nil
+	case reflect.Int32:
+		return strconv.FormatInt(int64(v.Interface().(int32)), 10), nil
+	case reflect.Int64:
+		return strconv.FormatInt(v.Interface().(int64), 10), nil
+	case reflect.Uint:
+		return strconv.FormatUint(uint64(v.Interface().(uint)), 10), nil
+	case reflect.Uint8:
+		return strconv.FormatUint(uint64(v.Interface().(uint8)), 10), nil
+	case reflect.Uint16:
+		return strconv.FormatUint(uint64(v.Interface().(uint16)), 10), nil
+	case reflect.Uint32:
+		return strconv.FormatUint(uint64(v.Interface().(uint32)), 10), nil
+	case reflect.Uint64:
+		return strconv.FormatUint(v.Interface().(uint64), 10), nil
+	default:
+		// We had a JSON float (numeric), but our field was not one of the
+		// allowed numeric types
+		return "", ErrBadJSONAPIID
+	}
+}
+
+// visitModelNodeMeta marshals fieldValue, the value of a meta field, into the
+// meta of node. A field annotated with a member name is encoded like an
+// attribute; a field annotated without one holds the whole meta object and is
+// encoded with encoding/json.
+func visitModelNodeMeta(field *fieldPlan, node *Node, fieldValue reflect.Value, state *marshalState) error {
+	meta := map[string]interface{}{}
+
+	if field.name == "" {
+		if fieldValue.Kind() == reflect.Ptr && fieldValue.IsNil() {
+			return nil
+		}
+
+		data, err := json.Marshal(fieldValue.Interface())
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("%w: meta must be a JSON object: %v", ErrInvalidType, err)
+		}
+	} else {
+		// Meta members are encoded like attributes, into a scratch node
+		scratch := new(Node)
+		if err := visitModelNodeAttribute(field, scratch, fieldValue, state); err != nil {
+			return err
+		}
+		for k, v := range scratch.Attributes {
+			meta[k] = v
+		}
+	}
+
+	if len(meta) == 0 {
+		return nil
+	}
+	if node.Meta == nil {
+		node.Meta = &Meta{}
+	}
+	for k, v := range meta {
+		(*node.Meta)[k] = v
+	}
+	return nil
+}
+
 // toShallowNode takes a node and returns a shallow version of the node.
 // If the ID is empty, we include attributes into the shallow version.
 //
@@ -705,8 +975,8 @@ func toShallowNode(node *Node) *Node {
 	return ret
 }
 
-func visitModelNodeRelationships(models reflect.Value, included *map[string]*Node,
-	sideload bool) (*RelationshipManyNode, error) {
+func visitModelNodeRelationships(models reflect.Value, name string, follow bool,
+	included *map[string]*Node, sideload bool, state *marshalState) (*RelationshipManyNode, error) {
 	nodes := []*Node{}
 
 	for i := 0; i < models.Len(); i++ {
@@ -717,7 +987,7 @@ func visitModelNodeRelationships(models reflect.Value, included *map[string]*Nod
 
 		n := model.Interface()
 
-		node, err := visitModelNode(n, included, sideload)
+		node, err := visitRelatedModel(n, name, follow, included, sideload, state)
 		if err != nil {
 			return nil, err
 		}
@@ -742,17 +1012,166 @@ func appendIncluded(m *map[string]*Node, nodes ...*Node) {
 	}
 }
 
-func nodeMapValues(m *map[string]*Node) []*Node {
-	mp := *m
-	nodes := make([]*Node, len(mp))
+// excludePrimary removes the nodes of the primary data from included, where
+// a cycle of the model graph leading back to them has put them.
+func excludePrimary(included map[string]*Node, data ...*Node) {
+	for _, n := range data {
+		if n == nil {
+			continue
+		}
+		k := fmt.Sprintf("%s,%s", n.Type, n.ID)
+		if included[k] == n {
+			delete(included, k)
+		}
+	}
+}
+
+// includedNodes returns the resources of included, referenced by the
+// resources of data, in the order set by the IncludedOrder option.
+func includedNodes(data []*Node, included map[string]*Node, opts *marshalOptions) []*Node {
+	refs := newReferenceOrder(included)
+	for _, n := range data {
+		refs.visit(n)
+	}
+	return refs.nodes(opts.includedOrder)
+}
+
+// referenceOrder records the order in which the resources to sideload are
+// first referenced, walking the relationships of the resources visited.
+type referenceOrder struct {
+	included map[string]*Node
+	seen     map[string]bool
+	ordered  []*Node
+}
+
+func newReferenceOrder(included map[string]*Node) *referenceOrder {
+	return &referenceOrder{included: included, seen: map[string]bool{}}
+}
+
+// visit records the resources to sideload referenced by the relationships of
+// n, by relationship name, in linkage order.
+func (r *referenceOrder) visit(n *Node) {
+	if n == nil {
+		return
+	}
+	for _, name := range sortedKeys(n.Relationships) {
+		var linkage []*Node
+		switch relationship := n.Relationships[name].(type) {
+		case *RelationshipOneNode:
+			linkage = []*Node{relationship.Data}
+		case *RelationshipManyNode:
+			linkage = relationship.Data
+		}
+
+		for _, l := range linkage {
+			if l == nil {
+				continue
+			}
+			key := fmt.Sprintf("%s,%s", l.Type, l.ID)
+			if included, ok := r.included[key]; ok && !r.seen[key] {
+				r.seen[key] = true
+				r.ordered = append(r.ordered, included)
+			}
+		}
+	}
+}
+
+// nodes returns every resource to sideload in the given order. In reference
+// order, the resources referenced so far come first, followed breadth first
+// by the resources they reference in turn.
+func (r *referenceOrder) nodes(order IncludedOrder) []*Node {
+	if order == IncludedSorted {
+		nodes := make([]*Node, 0, len(r.included))
+		for _, n := range r.included {
+			nodes = append(nodes, n)
+		}
+		sortNodes(nodes)
+		return nodes
+	}
+
+	for i := 0; i < len(r.ordered); i++ {
+		r.visit(r.ordered[i])
+	}
+
+	// Resources that are not referenced at all, if any, come last
+	var rest []*Node
+	for key, n := range r.included {
+		if !r.seen[key] {
+			rest = append(rest, n)
+		}
+	}
+	sortNodes(rest)
+
+	return append(r.ordered[:len(r.ordered):len(r.ordered)], rest...)
+}
+
+// sortNodes sorts nodes by type, then by ID. IDs that are both integers are
+// compared numerically.
+func sortNodes(nodes []*Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if isDigits(a.ID) && isDigits(b.ID) && len(a.ID) != len(b.ID) {
+			return len(a.ID) < len(b.ID)
+		}
+		return a.ID < b.ID
+	})
+}
+
+// isDigits reports whether s is a non-empty string of decimal digits without
+// leading zeros.
+func isDigits(s string) bool {
+	if s == "" || (s[0] == '0' && len(s) > 1) {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// writePayload writes payload to w as JSON, followed by a newline, once it
+// is checked against the limits. relationship is set for relationship
+// documents, whose data is resource linkage.
+func writePayload(w io.Writer, payload interface{}, opts *marshalOptions, relationship bool) error {
+	buf := bytes.NewBuffer(nil)
+	if err := encodeJSON(buf, payload, opts); err != nil {
+		return err
+	}
+
+	if opts.limits != (Limits{}) {
+		if err := newLimitScanner(opts.limits, relationship).scan(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodeJSON writes v to w as JSON, followed by a newline.
+func encodeJSON(w io.Writer, v interface{}, opts *marshalOptions) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(!opts.canonical)
+	return enc.Encode(v)
+}
 
-	i := 0
-	for _, n := range mp {
-		nodes[i] = n
-		i++
+// marshalJSON returns the JSON encoding of v, as json.Marshal does, but
+// without escaping HTML characters with the Canonical option.
+func marshalJSON(v interface{}, opts *marshalOptions) ([]byte, error) {
+	if !opts.canonical {
+		return json.Marshal(v)
 	}
 
-	return nodes
+	buf := bytes.NewBuffer(nil)
+	if err := encodeJSON(buf, v, opts); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
 
 func convertToSliceInterface(i *interface{}) ([]interface{}, error) {
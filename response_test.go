@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"reflect"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -1648,3 +1650,657 @@ func testBlog() *Blog {
 		},
 	}
 }
+
+func TestMarshalPayload_marshalerAttributes(t *testing.T) {
+	green := Green
+	gadget := &Gadget{
+		ID:            "1",
+		Color:         Red,
+		ColorPtr:      &green,
+		Price:         Money{Cents: 1999},
+		Addr:          netip.MustParseAddr("192.0.2.1"),
+		NullableColor: NewNullableAttrWithValue(Green),
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, gadget); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload struct {
+		Data struct {
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"color":          "red",
+		"color-ptr":      "green",
+		"price":          "1999",
+		"addr":           "192.0.2.1",
+		"nullable-color": "green",
+	}
+	if !reflect.DeepEqual(payload.Data.Attributes, expected) {
+		t.Fatalf("Expected attributes %v, got %v", expected, payload.Data.Attributes)
+	}
+
+	gadget.Color = 0
+	if err := MarshalPayload(out, gadget); err == nil || !strings.Contains(err.Error(), "unknown color") {
+		t.Fatalf("Expected the MarshalText error, got %v", err)
+	}
+}
+
+func TestMarshalPayload_collectionAttributes(t *testing.T) {
+	one := 1
+	hiredAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	collections := &Collections{
+		ID:      "1",
+		Ints:    []int{1, 2},
+		IntPtrs: []*int{&one, nil},
+		Triple:  [3]uint8{1, 2, 3},
+		Bytes:   []byte("hi"),
+		Counts:  map[string]int{"a": 1},
+		Tags:    map[string][]string{"go": {"fast"}},
+		ByYear:  map[int]string{2020: "covid"},
+		Bosses:  map[string]*Employee{"ceo": {Firstname: "Jane", HiredAt: &hiredAt}},
+		Dates:   []time.Time{hiredAt},
+		Colors:  []Color{Red, Green},
+		Grid:    [][]int{{1}, {2, 3}},
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, collections); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload struct {
+		Data struct {
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"ints":     []interface{}{float64(1), float64(2)},
+		"int-ptrs": []interface{}{float64(1), nil},
+		"triple":   []interface{}{float64(1), float64(2), float64(3)},
+		"bytes":    "aGk=",
+		"counts":   map[string]interface{}{"a": float64(1)},
+		"tags":     map[string]interface{}{"go": []interface{}{"fast"}},
+		"by-year":  map[string]interface{}{"2020": "covid"},
+		"bosses": map[string]interface{}{
+			"ceo": map[string]interface{}{
+				"firstname": "Jane",
+				"surname":   "",
+				"age":       float64(0),
+				"hired-at":  "2020-01-02T03:04:05Z",
+			},
+		},
+		"dates":  []interface{}{"2020-01-02T03:04:05Z"},
+		"colors": []interface{}{"red", "green"},
+		"grid":   []interface{}{[]interface{}{float64(1)}, []interface{}{float64(2), float64(3)}},
+	}
+	for name, value := range expected {
+		if !reflect.DeepEqual(payload.Data.Attributes[name], value) {
+			t.Errorf("Expected %q to be %#v, got %#v", name, value, payload.Data.Attributes[name])
+		}
+	}
+	for _, name := range []string{"floats", "bools", "anything"} {
+		if _, ok := payload.Data.Attributes[name]; ok {
+			t.Errorf("Expected empty %q to be omitted", name)
+		}
+	}
+}
+
+func TestMarshalPayload_embeddedStructs(t *testing.T) {
+	createdAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	widget := &Widget{
+		BaseModel: BaseModel{ID: "1", Timestamps: Timestamps{CreatedAt: createdAt}},
+		Name:      "Sprocket",
+		Owner:     &Comment{ID: 2},
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, widget); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload OnePayload
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Data.Type != "widgets" || payload.Data.ID != "1" {
+		t.Fatalf("Unexpected resource %s/%s", payload.Data.Type, payload.Data.ID)
+	}
+	expected := map[string]interface{}{
+		"name":       "Sprocket",
+		"created_at": "2020-01-02T03:04:05Z",
+	}
+	if !reflect.DeepEqual(payload.Data.Attributes, expected) {
+		t.Fatalf("Expected attributes %v, got %v", expected, payload.Data.Attributes)
+	}
+	if _, ok := payload.Data.Relationships["owner"]; !ok {
+		t.Fatalf("Expected the owner relationship, got %v", payload.Data.Relationships)
+	}
+}
+
+func TestMarshalPayload_embeddedStructPointers(t *testing.T) {
+	updatedAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		desc     string
+		gizmo    *Gizmo
+		expected map[string]interface{}
+	}{
+		{
+			desc:     "nil",
+			gizmo:    &Gizmo{ID: "1", CreatedAt: "yesterday"},
+			expected: map[string]interface{}{"created_at": "yesterday"},
+		},
+		{
+			desc: "set",
+			gizmo: &Gizmo{
+				BaseModel: &BaseModel{ID: "2", Timestamps: Timestamps{UpdatedAt: &updatedAt}},
+				ID:        "1",
+				CreatedAt: "yesterday",
+			},
+			expected: map[string]interface{}{
+				"created_at": "yesterday",
+				"updated_at": "2021-01-02T03:04:05Z",
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := bytes.NewBuffer(nil)
+			if err := MarshalPayload(out, tc.gizmo); err != nil {
+				t.Fatal(err)
+			}
+
+			var payload OnePayload
+			if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+				t.Fatal(err)
+			}
+
+			if payload.Data.Type != "gizmos" || payload.Data.ID != "1" {
+				t.Fatalf("Unexpected resource %s/%s", payload.Data.Type, payload.Data.ID)
+			}
+			if !reflect.DeepEqual(payload.Data.Attributes, tc.expected) {
+				t.Fatalf("Expected attributes %v, got %v", tc.expected, payload.Data.Attributes)
+			}
+		})
+	}
+}
+
+func TestMarshalPayload_promotedEmbeddedFields(t *testing.T) {
+	keys := func(m map[string]interface{}) []string {
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+
+	for _, tc := range []struct {
+		desc          string
+		model         interface{}
+		attributes    []string
+		relationships []string
+	}{
+		{
+			desc:          "without embedded struct",
+			model:         &Post{ID: 1, BlogID: 2, Title: "Title", Body: "Body"},
+			attributes:    []string{"blog_id", "body", "title"},
+			relationships: []string{"comments", "latest_comment"},
+		},
+		{
+			// The fields of Blog that BlogPost does not shadow are promoted,
+			// and written along with those of BlogPost
+			desc:          "with embedded struct",
+			model:         &BlogPost{ID: 1, Title: "Title", Body: "Body"},
+			attributes:    []string{"body", "current_post_id", "title", "view_count"},
+			relationships: []string{"current_post", "posts"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := bytes.NewBuffer(nil)
+			if err := MarshalPayload(out, tc.model); err != nil {
+				t.Fatal(err)
+			}
+
+			var payload OnePayload
+			if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+				t.Fatal(err)
+			}
+
+			if payload.Data.Type != "posts" || payload.Data.ID != "1" {
+				t.Fatalf("Unexpected resource %s/%s", payload.Data.Type, payload.Data.ID)
+			}
+			if e, a := tc.attributes, keys(payload.Data.Attributes); !reflect.DeepEqual(e, a) {
+				t.Fatalf("Expected attributes %v, got %v", e, a)
+			}
+			if e, a := tc.relationships, keys(payload.Data.Relationships); !reflect.DeepEqual(e, a) {
+				t.Fatalf("Expected relationships %v, got %v", e, a)
+			}
+			if payload.Data.Attributes["title"] != "Title" {
+				t.Fatalf("Expected the title of the post, got %v", payload.Data.Attributes["title"])
+			}
+		})
+	}
+}
+
+func TestMarshalPayload_metaFields(t *testing.T) {
+	article := &Article{
+		ID:          "1",
+		Title:       "Hello",
+		TotalViews:  42,
+		PublishedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		Rating:      NewNullNullableAttr[float64](),
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalPayload(out, article); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload OnePayload
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Meta{
+		"total_views":  float64(42),
+		"published_at": "2020-01-02T03:04:05Z",
+		"rating":       nil,
+		"source":       "metable",
+	}
+	if !reflect.DeepEqual(payload.Data.Meta, expected) {
+		t.Fatalf("Expected meta %v, got %v", expected, payload.Data.Meta)
+	}
+	if _, ok := payload.Data.Attributes["total_views"]; ok {
+		t.Fatal("Expected meta fields not to be marshaled as attributes")
+	}
+}
+
+func TestMarshalPayload_wholeMeta(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		model    interface{}
+		expected *Meta
+	}{
+		{"struct", &ArticleWithStats{ID: "1", Stats: &ArticleStats{Views: 3}}, &Meta{"views": float64(3)}},
+		{"nil struct", &ArticleWithStats{ID: "1"}, nil},
+		{"map", &ArticleWithMeta{ID: "1", Meta: Meta{"views": 3}}, &Meta{"views": float64(3)}},
+		{"empty map", &ArticleWithMeta{ID: "1"}, nil},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := bytes.NewBuffer(nil)
+			if err := MarshalPayload(out, tc.model); err != nil {
+				t.Fatal(err)
+			}
+
+			var payload OnePayload
+			if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(payload.Data.Meta, tc.expected) {
+				t.Fatalf("Expected meta %v, got %v", tc.expected, payload.Data.Meta)
+			}
+		})
+	}
+}
+
+func testOrderedBlog() *Blog {
+	first := &Post{ID: 1, Title: "First", Comments: []*Comment{{ID: 10, Body: "<b>Hi</b>"}, {ID: 2}}}
+	second := &Post{ID: 2, Title: "Second", Comments: []*Comment{{ID: 1}}}
+	return &Blog{
+		ID:          1,
+		Title:       "Blog",
+		Posts:       []*Post{second, first},
+		CurrentPost: first,
+	}
+}
+
+func TestMarshal_cycles(t *testing.T) {
+	// The identity map of the document links the models into a cycle: the
+	// novel is the first of the novels of its author
+	in := strings.NewReader(`{
+		"data": {
+			"type": "novels",
+			"id": "1",
+			"relationships": {
+				"author": {"data": {"type": "authors", "id": "1"}}
+			}
+		},
+		"included": [
+			{
+				"type": "authors",
+				"id": "1",
+				"relationships": {
+					"novels": {"data": [{"type": "novels", "id": "1"}, {"type": "novels", "id": "2"}]}
+				}
+			},
+			{
+				"type": "novels",
+				"id": "2",
+				"relationships": {
+					"author": {"data": {"type": "authors", "id": "1"}}
+				}
+			}
+		]
+	}`)
+	novel := new(Novel)
+	if err := UnmarshalPayload(in, novel); err != nil {
+		t.Fatal(err)
+	}
+	if novel.Author.Novels[0] != novel || novel.Author.Novels[1].Author != novel.Author {
+		t.Fatal("Expected the unmarshaled models to form a cycle")
+	}
+
+	payload, err := Marshal(novel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := payload.(*OnePayload)
+
+	if e, a := []string{"authors,1", "novels,2"}, includedKeys(one.Included); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected included %v, got %v", e, a)
+	}
+	novels := one.Included[0].Relationships["novels"].(*RelationshipManyNode)
+	if e, a := []string{"novels,1", "novels,2"}, includedKeys(novels.Data); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected novels linkage %v, got %v", e, a)
+	}
+	author := one.Included[1].Relationships["author"].(*RelationshipOneNode)
+	if author.Data == nil || author.Data.ID != "1" || len(author.Data.Attributes) != 0 {
+		t.Fatalf("Expected a resource identifier, got %+v", author.Data)
+	}
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalOnePayloadEmbedded(out, novel); err != nil {
+		t.Fatal(err)
+	}
+
+	var embedded OnePayload
+	if err := json.Unmarshal(out.Bytes(), &embedded); err != nil {
+		t.Fatal(err)
+	}
+	// Embedded, the novel is identified where the cycle leads back to it
+	embeddedAuthor := embedded.Data.Relationships["author"].(map[string]interface{})["data"].(map[string]interface{})
+	self := embeddedAuthor["relationships"].(map[string]interface{})["novels"].(map[string]interface{})["data"].([]interface{})[0]
+	if e := map[string]interface{}{"type": "novels", "id": "1"}; !reflect.DeepEqual(self, e) {
+		t.Fatalf("Expected %v, got %v", e, self)
+	}
+
+	out.Reset()
+	enc := NewStreamEncoder(out)
+	if err := enc.Encode(novel); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var many ManyPayload
+	if err := json.Unmarshal(out.Bytes(), &many); err != nil {
+		t.Fatal(err)
+	}
+	if e, a := []string{"authors,1", "novels,2"}, includedKeys(many.Included); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected streamed included %v, got %v", e, a)
+	}
+}
+
+func includedKeys(nodes []*Node) []string {
+	keys := make([]string, len(nodes))
+	for i, n := range nodes {
+		keys[i] = n.Type + "," + n.ID
+	}
+	return keys
+}
+
+func TestMarshal_includedOrder(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		opts     []MarshalOption
+		expected []string
+	}{
+		{
+			"reference order",
+			nil,
+			[]string{"posts,1", "posts,2", "comments,10", "comments,2", "comments,1"},
+		},
+		{
+			"sorted",
+			[]MarshalOption{OrderIncluded(IncludedSorted)},
+			[]string{"comments,1", "comments,2", "comments,10", "posts,1", "posts,2"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				payload, err := Marshal(testOrderedBlog(), tc.opts...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if keys := includedKeys(payload.(*OnePayload).Included); !reflect.DeepEqual(keys, tc.expected) {
+					t.Fatalf("Expected included %v, got %v", tc.expected, keys)
+				}
+			}
+		})
+	}
+}
+
+func TestMarshal_includedOrderMany(t *testing.T) {
+	blogs := []*Blog{
+		{ID: 1, CurrentPost: &Post{ID: 3}},
+		{ID: 2, CurrentPost: &Post{ID: 1}, Posts: []*Post{{ID: 2}}},
+	}
+
+	payload, err := Marshal(blogs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"posts,3", "posts,1", "posts,2"}
+	if keys := includedKeys(payload.(*ManyPayload).Included); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected included %v, got %v", expected, keys)
+	}
+}
+
+func TestMarshalPayload_canonical(t *testing.T) {
+	var first []byte
+	for i := 0; i < 20; i++ {
+		out := bytes.NewBuffer(nil)
+		if err := MarshalPayload(out, testOrderedBlog(), Canonical()); err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			first = out.Bytes()
+			continue
+		}
+		if !bytes.Equal(first, out.Bytes()) {
+			t.Fatalf("Expected identical output, got\n%s\nand\n%s", first, out.Bytes())
+		}
+	}
+
+	if !bytes.Contains(first, []byte(`"<b>Hi</b>"`)) {
+		t.Fatalf("Expected HTML characters not to be escaped, got %s", first)
+	}
+	if i, j := bytes.Index(first, []byte(`"comments","id":"1"`)), bytes.Index(first, []byte(`"comments","id":"10"`)); i < 0 || i > j {
+		t.Fatalf("Expected sorted included resources, got %s", first)
+	}
+}
+
+func TestStreamEncoder_includedOrder(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	enc := NewStreamEncoder(out)
+	for _, blog := range []*Blog{
+		{ID: 1, CurrentPost: &Post{ID: 3}},
+		{ID: 2, CurrentPost: &Post{ID: 1, Comments: []*Comment{{ID: 5}}}},
+	} {
+		if err := enc.Encode(blog); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var payload ManyPayload
+	if err := json.Unmarshal(out.Bytes(), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"posts,3", "posts,1", "comments,5"}
+	if keys := includedKeys(payload.Included); !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("Expected included %v, got %v", expected, keys)
+	}
+}
+
+func TestMarshal_sparseFieldsets(t *testing.T) {
+	blog := testOrderedBlog()
+	blog.Posts = blog.Posts[:1]
+	blog.CurrentPost.Comments = []*Comment{{ID: 3, Body: "Hi"}}
+
+	payload, err := Marshal(blog, SparseFieldsets(map[string][]string{
+		"blogs":    {"title", "posts"},
+		"posts":    {"body", "comments"},
+		"comments": {},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := payload.(*OnePayload)
+
+	if one.Data.Type != "blogs" || one.Data.ID != "1" {
+		t.Fatalf("Expected the type and id to be kept, got %s,%s", one.Data.Type, one.Data.ID)
+	}
+	if e, a := []string{"title"}, sortedKeys(one.Data.Attributes); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected attributes %v, got %v", e, a)
+	}
+	if e, a := []string{"posts"}, sortedKeys(one.Data.Relationships); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected relationships %v, got %v", e, a)
+	}
+
+	// The current post and its comments are only related through the
+	// current_post relationship, which is left out
+	if e, a := []string{"posts,2", "comments,1"}, includedKeys(one.Included); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected included %v, got %v", e, a)
+	}
+
+	post := one.Included[0]
+	if e, a := []string{"body"}, sortedKeys(post.Attributes); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected post attributes %v, got %v", e, a)
+	}
+	if e, a := []string{"comments"}, sortedKeys(post.Relationships); !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected post relationships %v, got %v", e, a)
+	}
+
+	comment := one.Included[1]
+	if len(comment.Attributes) != 0 || len(comment.Relationships) != 0 {
+		t.Fatalf("Expected an empty fieldset for comments, got %+v", comment)
+	}
+}
+
+type linkableBlogs []*Blog
+
+func (b linkableBlogs) JSONAPILinks() *Links {
+	return &Links{"self": "https://example.com/api/blogs", "next": "https://example.com/api/blogs?page=2"}
+}
+
+func (b linkableBlogs) JSONAPIMeta() *Meta {
+	return &Meta{"total": len(b), "source": "metable"}
+}
+
+func TestMarshal_topLevelMembers(t *testing.T) {
+	opts := []MarshalOption{
+		TopLevelLinks(&Links{"self": "https://example.com/api/blogs?sort=title"}),
+		TopLevelMeta(&Meta{"source": "option"}),
+		TopLevelJSONAPI(&JSONAPIObject{Version: "1.1"}),
+	}
+
+	payload, err := Marshal(testBlog(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := payload.(*OnePayload)
+
+	if e, a := (&Links{"self": "https://example.com/api/blogs?sort=title"}), one.Links; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected links %v, got %v", e, a)
+	}
+	if e, a := (&Meta{"source": "option"}), one.Meta; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected meta %v, got %v", e, a)
+	}
+	if one.JSONAPI == nil || one.JSONAPI.Version != "1.1" {
+		t.Fatalf("Expected the jsonapi object, got %+v", one.JSONAPI)
+	}
+	// The links and meta of the resource itself are kept on the resource
+	if one.Data.Links == nil || (*one.Data.Meta)["detail"] == nil {
+		t.Fatalf("Expected the links and meta of the resource, got %+v", one.Data)
+	}
+
+	payload, err = Marshal(linkableBlogs{testBlog()}, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	many := payload.(*ManyPayload)
+
+	expectedLinks := &Links{"self": "https://example.com/api/blogs?sort=title", "next": "https://example.com/api/blogs?page=2"}
+	if !reflect.DeepEqual(many.Links, expectedLinks) {
+		t.Fatalf("Expected links %v, got %v", expectedLinks, many.Links)
+	}
+	if e, a := (&Meta{"total": 1, "source": "option"}), many.Meta; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected meta %v, got %v", e, a)
+	}
+	if many.JSONAPI == nil || many.JSONAPI.Version != "1.1" {
+		t.Fatalf("Expected the jsonapi object, got %+v", many.JSONAPI)
+	}
+}
+
+func TestMarshal_invalidTopLevelLinks(t *testing.T) {
+	if _, err := Marshal(testBlog(), TopLevelLinks(&Links{"self": 1})); err == nil {
+		t.Fatal("Expected an error for an invalid link")
+	}
+}
+
+// benchmarkBlogs returns n blogs, each with two posts and a comment.
+func benchmarkBlogs(n int) []*Blog {
+	blogs := make([]*Blog, n)
+	for i := range blogs {
+		post := &Post{
+			ID:            uint64(i + 1),
+			BlogID:        i + 1,
+			Title:         "Title",
+			Body:          "Body",
+			Comments:      []*Comment{{ID: i + 1, PostID: i + 1, Body: "Comment"}},
+			LatestComment: &Comment{ID: i + 1, PostID: i + 1, Body: "Comment"},
+		}
+		blogs[i] = &Blog{
+			ID:            i + 1,
+			Title:         "Title",
+			Posts:         []*Post{post, {ID: uint64(n + i + 1), Title: "Draft"}},
+			CurrentPost:   post,
+			CurrentPostID: i + 1,
+			CreatedAt:     time.Unix(int64(i), 0),
+			ViewCount:     i,
+		}
+	}
+	return blogs
+}
+
+func BenchmarkMarshalPayload_many(b *testing.B) {
+	blogs := benchmarkBlogs(500)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := MarshalPayload(bytes.NewBuffer(nil), blogs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -35,6 +35,9 @@ const (
 // state, designed for instrumenting serialization timings.
 type Runtime struct {
 	ctx map[string]interface{}
+
+	// codecs holds the attribute codecs registered with the runtime.
+	codecs *codecRegistry
 }
 
 // Events is the func type that provides the callback for handling event timings.
@@ -45,7 +48,9 @@ type Events func(*Runtime, Event, string, time.Duration)
 var Instrumentation Events
 
 // NewRuntime creates a Runtime for use in an application.
-func NewRuntime() *Runtime { return &Runtime{make(map[string]interface{})} }
+func NewRuntime() *Runtime {
+	return &Runtime{ctx: make(map[string]interface{}), codecs: new(codecRegistry)}
+}
 
 // WithValue adds custom state variables to the runtime context.
 func (r *Runtime) WithValue(key string, value interface{}) *Runtime {
@@ -59,6 +64,31 @@ func (r *Runtime) Value(key string) interface{} {
 	return r.ctx[key]
 }
 
+// RegisterAttributeCodec registers the functions used to encode and decode
+// attributes of type t by this runtime only. These take precedence over the
+// codecs registered with the package level RegisterAttributeCodec, which has
+// more docs.
+func (r *Runtime) RegisterAttributeCodec(t reflect.Type, encode AttributeEncoder, decode AttributeDecoder) *Runtime {
+	if r.codecs == nil {
+		r.codecs = new(codecRegistry)
+	}
+	r.codecs.register(t, encode, decode)
+
+	return r
+}
+
+// unmarshalOptions returns opts, preceded by the options carrying the state
+// of the runtime.
+func (r *Runtime) unmarshalOptions(opts []UnmarshalOption) []UnmarshalOption {
+	return append([]UnmarshalOption{func(o *unmarshalOptions) { o.codecs = r.codecs }}, opts...)
+}
+
+// marshalOptions returns opts, preceded by the options carrying the state of
+// the runtime.
+func (r *Runtime) marshalOptions(opts []MarshalOption) []MarshalOption {
+	return append([]MarshalOption{func(o *marshalOptions) { o.codecs = r.codecs }}, opts...)
+}
+
 // Instrument is deprecated.
 func (r *Runtime) Instrument(key string) *Runtime {
 	return r.WithValue("instrument", key)
@@ -69,16 +99,59 @@ func (r *Runtime) shouldInstrument() bool {
 }
 
 // UnmarshalPayload has docs in request.go for UnmarshalPayload.
-func (r *Runtime) UnmarshalPayload(reader io.Reader, model interface{}) error {
+func (r *Runtime) UnmarshalPayload(reader io.Reader, model interface{}, opts ...UnmarshalOption) error {
 	return r.instrumentCall(UnmarshalStart, UnmarshalStop, func() error {
-		return UnmarshalPayload(reader, model)
+		return UnmarshalPayload(reader, model, r.unmarshalOptions(opts)...)
 	})
 }
 
 // UnmarshalManyPayload has docs in request.go for UnmarshalManyPayload.
-func (r *Runtime) UnmarshalManyPayload(reader io.Reader, kind reflect.Type) (elems []interface{}, err error) {
+func (r *Runtime) UnmarshalManyPayload(reader io.Reader, kind reflect.Type, opts ...UnmarshalOption) (elems []interface{}, err error) {
+	r.instrumentCall(UnmarshalStart, UnmarshalStop, func() error { //nolint:errcheck
+		elems, err = UnmarshalManyPayload(reader, kind, r.unmarshalOptions(opts)...)
+		return err
+	})
+
+	return
+}
+
+// RuntimeUnmarshalOne is the Runtime equivalent of UnmarshalOne. Methods
+// cannot have type parameters, so it takes the Runtime as its first argument.
+func RuntimeUnmarshalOne[T any](r *Runtime, reader io.Reader, opts ...UnmarshalOption) (model *T, err error) {
+	r.instrumentCall(UnmarshalStart, UnmarshalStop, func() error { //nolint:errcheck
+		model, err = UnmarshalOne[T](reader, r.unmarshalOptions(opts)...)
+		return err
+	})
+
+	return
+}
+
+// RuntimeUnmarshalMany is the Runtime equivalent of UnmarshalMany.
+func RuntimeUnmarshalMany[T any](r *Runtime, reader io.Reader, opts ...UnmarshalOption) (models []*T, err error) {
+	r.instrumentCall(UnmarshalStart, UnmarshalStop, func() error { //nolint:errcheck
+		models, err = UnmarshalMany[T](reader, r.unmarshalOptions(opts)...)
+		return err
+	})
+
+	return
+}
+
+// RuntimeUnmarshalOneDocument is the Runtime equivalent of
+// UnmarshalOneDocument.
+func RuntimeUnmarshalOneDocument[T any](r *Runtime, reader io.Reader, opts ...UnmarshalOption) (doc *Document[*T], err error) {
+	r.instrumentCall(UnmarshalStart, UnmarshalStop, func() error { //nolint:errcheck
+		doc, err = UnmarshalOneDocument[T](reader, r.unmarshalOptions(opts)...)
+		return err
+	})
+
+	return
+}
+
+// RuntimeUnmarshalManyDocument is the Runtime equivalent of
+// UnmarshalManyDocument.
+func RuntimeUnmarshalManyDocument[T any](r *Runtime, reader io.Reader, opts ...UnmarshalOption) (doc *Document[[]*T], err error) {
 	r.instrumentCall(UnmarshalStart, UnmarshalStop, func() error { //nolint:errcheck
-		elems, err = UnmarshalManyPayload(reader, kind)
+		doc, err = UnmarshalManyDocument[T](reader, r.unmarshalOptions(opts)...)
 		return err
 	})
 
@@ -86,9 +159,9 @@ func (r *Runtime) UnmarshalManyPayload(reader io.Reader, kind reflect.Type) (ele
 }
 
 // MarshalPayload has docs in response.go for MarshalPayload.
-func (r *Runtime) MarshalPayload(w io.Writer, model interface{}) error {
+func (r *Runtime) MarshalPayload(w io.Writer, model interface{}, opts ...MarshalOption) error {
 	return r.instrumentCall(MarshalStart, MarshalStop, func() error {
-		return MarshalPayload(w, model)
+		return MarshalPayload(w, model, r.marshalOptions(opts)...)
 	})
 }
 
@@ -0,0 +1,498 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// ErrIncludedAfterData is returned by UnmarshalManyStream, with the
+// IncludedReject policy, for documents whose "included" array comes after
+// their "data" array.
+var ErrIncludedAfterData = errors.New("included resources come after the primary data")
+
+// IncludedPolicy tells UnmarshalManyStream how to handle an "included" array
+// that comes after the "data" array of the document. JSON objects are
+// unordered, so a document may hold its members in any order.
+type IncludedPolicy int
+
+const (
+	// IncludedIgnore unmarshals each resource of the primary data as soon as
+	// it is read. The relationships of resources read before the "included"
+	// array cannot be resolved against it and only hold their linkage. This
+	// is the default.
+	IncludedIgnore IncludedPolicy = iota
+	// IncludedBuffer holds the resources of the primary data back, still
+	// undecoded, until the "included" array or the end of the document is
+	// read, so that their relationships are always resolved. Memory use then
+	// grows with the size of the primary data.
+	IncludedBuffer
+	// IncludedReject fails with ErrIncludedAfterData.
+	IncludedReject
+)
+
+// UnmarshalManyStream reads a collection document from in and unmarshals its
+// primary data one resource at a time, handing each model to fn as soon as it
+// is decoded, rather than holding the whole document and every model in
+// memory like UnmarshalManyPayload does. t should be the type of a pointer to
+// a struct, e.g. reflect.TypeOf(new(Blog)).
+//
+// Unmarshaling stops at the first error returned by fn, which is then
+// returned. The other top-level members of the document are returned in a
+// ManyPayload, whose Data is left empty. The "included" array is kept in
+// memory to resolve relationships; how it is handled when it comes after the
+// "data" array is set with the StreamIncluded option.
+//
+// With the CollectErrors option, models are handed to fn even when some of
+// their members could not be unmarshaled, and the errors are returned once
+// the whole document has been read.
+func UnmarshalManyStream(in io.Reader, t reflect.Type, fn func(model interface{}) error, opts ...UnmarshalOption) (*ManyPayload, error) {
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return nil, ErrUnexpectedType
+	}
+
+	s := newStreamDecoder(in, t, fn, newUnmarshalOptions(opts))
+	if err := s.decode(); err != nil {
+		return nil, err
+	}
+
+	return s.payload, nil
+}
+
+// UnmarshalEach is the type-safe equivalent of UnmarshalManyStream:
+//
+//	_, err := jsonapi.UnmarshalEach(r.Body, func(blog *Blog) error {
+//		return save(blog)
+//	})
+//
+// T must be a struct type; ErrUnexpectedType is returned otherwise.
+func UnmarshalEach[T any](in io.Reader, fn func(*T) error, opts ...UnmarshalOption) (*ManyPayload, error) {
+	return UnmarshalManyStream(in, reflect.TypeOf(new(T)), func(model interface{}) error {
+		return fn(model.(*T))
+	}, opts...)
+}
+
+// streamDecoder holds the state of UnmarshalManyStream.
+type streamDecoder struct {
+	dec     *json.Decoder
+	t       reflect.Type
+	fn      func(model interface{}) error
+	opts    *unmarshalOptions
+	payload *ManyPayload
+	state   *unmarshalState
+	// coercer is set with the Lenient option.
+	coercer *resourceCoercer
+
+	// count is the number of resources of the primary data read so far.
+	count int
+	// included is set once the "included" array has been read.
+	included bool
+	// pending holds the resources of the primary data held back by the
+	// IncludedBuffer policy, by index.
+	pending []*Node
+}
+
+func newStreamDecoder(in io.Reader, t reflect.Type, fn func(model interface{}) error, opts *unmarshalOptions) *streamDecoder {
+	s := &streamDecoder{
+		dec:     json.NewDecoder(newLimitReader(in, opts.limits, false)),
+		t:       t,
+		fn:      fn,
+		opts:    opts,
+		payload: new(ManyPayload),
+	}
+	s.dec.UseNumber()
+	s.state = newUnmarshalState(nil, opts)
+	// Only the models of included resources, which are shared by the
+	// resources of the primary data, are remembered
+	s.state.includedOnly = true
+	if opts.lenient {
+		s.coercer = newResourceCoercer(t, opts)
+	}
+	return s
+}
+
+func (s *streamDecoder) decode() error {
+	if err := expectDelim(s.dec, '{'); err != nil {
+		return err
+	}
+
+	for s.dec.More() {
+		token, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		name, _ := token.(string)
+
+		switch name {
+		case "data":
+			err = s.decodeData()
+		case "included":
+			err = s.decodeIncluded()
+		case "links":
+			err = s.dec.Decode(&s.payload.Links)
+		case "meta":
+			err = s.dec.Decode(&s.payload.Meta)
+		case "jsonapi":
+			err = s.dec.Decode(&s.payload.JSONAPI)
+		default:
+			s.state.reportIgnored([]string{name}, topLevelMembers, topLevelPointer)
+			if err = s.state.reportUnknownMembers([]string{name}, topLevelMembers, topLevelPointer); err == nil {
+				var skipped json.RawMessage
+				err = s.dec.Decode(&skipped)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := expectDelim(s.dec, '}'); err != nil {
+		return err
+	}
+
+	if err := s.flush(); err != nil {
+		return err
+	}
+	s.state.dropResolved()
+
+	if err := s.state.err(); err != nil {
+		return err
+	}
+
+	normalizeTopLevel(s.payload.Links, s.payload.Meta, s.payload.JSONAPI)
+	normalizeNodes(s.payload.Included)
+
+	return nil
+}
+
+// decodeData reads the "data" array, unmarshaling each of its resources in
+// turn.
+func (s *streamDecoder) decodeData() error {
+	token, err := s.dec.Token()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+	if token != json.Delim('[') {
+		return &UnmarshalError{Pointer: "/data", Type: s.t, Err: ErrExpectedSlice}
+	}
+
+	for s.dec.More() {
+		node := new(Node)
+		if err := s.decodeResources(node, "/data/"+strconv.Itoa(s.count)); err != nil {
+			return err
+		}
+
+		if !s.included && s.opts.includedPolicy == IncludedBuffer {
+			s.pending = append(s.pending, node)
+			s.count++
+			continue
+		}
+
+		if err := s.yield(node, s.count); err != nil {
+			return err
+		}
+		s.count++
+	}
+
+	return expectDelim(s.dec, ']')
+}
+
+// decodeIncluded reads the "included" array, which is then used to resolve
+// the relationships of the resources unmarshaled from then on.
+func (s *streamDecoder) decodeIncluded() error {
+	if s.count > 0 && s.opts.includedPolicy == IncludedReject {
+		return ErrIncludedAfterData
+	}
+
+	if err := s.decodeResources(&s.payload.Included, "/included"); err != nil {
+		return err
+	}
+
+	s.included = true
+	s.state.include(s.payload.Included)
+
+	if err := s.state.reportUnknownIncluded(s.payload.Included, s.t); err != nil {
+		return err
+	}
+
+	return s.flush()
+}
+
+// decodeResources decodes the next value of the document, a resource object
+// or an array of them found at pointer, into v. With the Lenient option, the
+// coercions of the resource ids and types are applied first.
+func (s *streamDecoder) decodeResources(v interface{}, pointer string) error {
+	if s.coercer == nil {
+		return s.dec.Decode(v)
+	}
+
+	var raw interface{}
+	if err := s.dec.Decode(&raw); err != nil {
+		return err
+	}
+
+	switch r := raw.(type) {
+	case map[string]interface{}:
+		s.coercer.resource(r, pointer)
+	case []interface{}:
+		s.coercer.resources(r, pointer)
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(bytes.NewReader(data), v)
+}
+
+// flush unmarshals the resources held back by the IncludedBuffer policy.
+func (s *streamDecoder) flush() error {
+	offset := s.count - len(s.pending)
+	for i, node := range s.pending {
+		if err := s.yield(node, offset+i); err != nil {
+			return err
+		}
+		s.pending[i] = nil
+	}
+	s.pending = nil
+	return nil
+}
+
+// yield unmarshals node, the i-th resource of the primary data, into a new
+// model and hands it to fn. Unlike UnmarshalManyPayload, only the models of
+// included resources are remembered, so that memory use does not grow with
+// the size of the primary data; of the primary data, only the keys are.
+func (s *streamDecoder) yield(node *Node, i int) error {
+	model := reflect.New(s.t.Elem())
+	s.state.rememberPrimary(node, model)
+	if err := unmarshalNode(node, model, s.state, location{pointer: "/data/" + strconv.Itoa(i)}); err != nil {
+		return err
+	}
+	return s.fn(model.Interface())
+}
+
+// expectDelim reads the next token of dec, which must be delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected %v, found %v", delim, token)
+	}
+	return nil
+}
+
+// StreamEncoder writes a collection document to an output stream one model at
+// a time, rather than building the whole document in memory like
+// MarshalPayload does. Only the resources to sideload into the "included"
+// array are held until the document is closed:
+//
+//	enc := jsonapi.NewStreamEncoder(w)
+//	for rows.Next() {
+//		if err := enc.Encode(scanBlog(rows)); err != nil {
+//			return err
+//		}
+//	}
+//	enc.SetMeta(&jsonapi.Meta{"total": count})
+//	return enc.Close()
+type StreamEncoder struct {
+	w        io.Writer
+	state    *marshalState
+	included map[string]*Node
+	refs     *referenceOrder
+	count    int
+	links    *Links
+	meta     *Meta
+	jsonapi  *JSONAPIObject
+	// scanner checks the document against the limits as it is written, nil
+	// when there are none.
+	scanner *limitScanner
+
+	// started is set once the opening of the document has been written.
+	started bool
+	// err is the first error met, returned by every later call.
+	err error
+}
+
+// NewStreamEncoder returns a StreamEncoder writing to w.
+func NewStreamEncoder(w io.Writer, opts ...MarshalOption) *StreamEncoder {
+	included := map[string]*Node{}
+	e := &StreamEncoder{
+		w:        w,
+		state:    newMarshalState(newMarshalOptions(opts)),
+		included: included,
+		refs:     newReferenceOrder(included),
+	}
+	if limits := e.state.opts.limits; limits != (Limits{}) {
+		e.scanner = newLimitScanner(limits, false)
+	}
+	return e
+}
+
+// Encode writes model, a pointer to a struct with jsonapi annotations, as the
+// next resource of the primary data, and records its related resources to
+// sideload.
+func (e *StreamEncoder) Encode(model interface{}) error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if v := reflect.ValueOf(model); v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		e.err = ErrUnexpectedType
+		return e.err
+	}
+	if err := e.state.checkInclude(reflect.TypeOf(model)); err != nil {
+		e.err = err
+		return err
+	}
+
+	node, err := visitModelNode(model, &e.included, true, e.state)
+	if err == nil {
+		excludePrimary(e.included, node)
+		err = e.checkLimits(node)
+	}
+	if err != nil {
+		e.err = err
+		return err
+	}
+	e.count++
+	e.refs.visit(node)
+
+	data, err := marshalJSON(node, e.state.opts)
+	if err != nil {
+		e.err = err
+		return err
+	}
+
+	separator := ","
+	if !e.started {
+		separator = `{"data":[`
+		e.started = true
+	}
+
+	return e.write([]byte(separator), data)
+}
+
+// checkLimits checks node, the next resource of the primary data, and the
+// resources to sideload so far against the limits.
+func (e *StreamEncoder) checkLimits(node *Node) error {
+	limits := e.state.opts.limits
+	if err := limits.check("MaxData", limits.MaxData, e.count+1, "/data"); err != nil {
+		return err
+	}
+	if err := limits.checkNode(node, "/data/"+strconv.Itoa(e.count)); err != nil {
+		return err
+	}
+	return limits.check("MaxIncluded", limits.MaxIncluded, len(e.included), "/included")
+}
+
+// SetLinks sets the top-level links of the document, written on Close. They
+// are added to those of the TopLevelLinks option, taking precedence over
+// them.
+func (e *StreamEncoder) SetLinks(links *Links) {
+	e.links = links
+}
+
+// SetMeta sets the top-level meta of the document, written on Close. Its
+// members are added to those of the TopLevelMeta option, taking precedence
+// over them.
+func (e *StreamEncoder) SetMeta(meta *Meta) {
+	e.meta = meta
+}
+
+// SetJSONAPI sets the top-level `jsonapi` object of the document, written on
+// Close, in place of that of the TopLevelJSONAPI option.
+func (e *StreamEncoder) SetJSONAPI(jsonapi *JSONAPIObject) {
+	e.jsonapi = jsonapi
+}
+
+// Close ends the document, writing the "included" array and the top-level
+// links, meta and jsonapi object. It does not close the underlying writer.
+func (e *StreamEncoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	if e.links != nil {
+		if err := e.links.validate(); err != nil {
+			e.err = err
+			return err
+		}
+	}
+
+	payload := &ManyPayload{Included: e.refs.nodes(e.state.opts.includedOrder)}
+	if err := e.state.opts.topLevel(&payload.Links, &payload.Meta, &payload.JSONAPI); err != nil {
+		e.err = err
+		return err
+	}
+	payload.Links = mergeLinks(payload.Links, e.links)
+	payload.Meta = mergeMeta(payload.Meta, e.meta)
+	if e.jsonapi != nil {
+		payload.JSONAPI = e.jsonapi
+	}
+
+	tail, err := marshalJSON(payload, e.state.opts)
+	if err != nil {
+		e.err = err
+		return err
+	}
+
+	// tail is {"data":null,...}, whose members follow those written so far
+	tail = tail[len(`{"data":null`):]
+
+	opening := "]"
+	if !e.started {
+		opening = `{"data":[]`
+		e.started = true
+	}
+
+	if err := e.write([]byte(opening), tail, []byte("\n")); err != nil {
+		return err
+	}
+
+	e.err = errors.New("jsonapi: StreamEncoder is closed")
+	return nil
+}
+
+// write writes chunks, the next bytes of the document, once they are checked
+// against the limits.
+func (e *StreamEncoder) write(chunks ...[]byte) error {
+	if e.scanner != nil {
+		for _, chunk := range chunks {
+			if err := e.scanner.scan(chunk); err != nil {
+				e.err = err
+				return err
+			}
+		}
+	}
+
+	for _, chunk := range chunks {
+		if _, err := e.w.Write(chunk); err != nil {
+			e.err = err
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalChannel writes a collection document to w holding every model
+// received from models, until it is closed. It is a shorthand for a
+// StreamEncoder. On error, MarshalChannel returns right away without draining
+// models.
+func MarshalChannel[T any](w io.Writer, models <-chan *T, opts ...MarshalOption) error {
+	enc := NewStreamEncoder(w, opts...)
+	for model := range models {
+		if err := enc.Encode(model); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
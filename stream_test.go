@@ -0,0 +1,379 @@
+package jsonapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const streamIncludedLast = `{
+	"data": [
+		{"type": "novels", "id": "1", "attributes": {"title": "Dune"}, "relationships": {"author": {"data": {"type": "authors", "id": "1"}}}},
+		{"type": "novels", "id": "2", "attributes": {"title": "Dune Messiah"}, "relationships": {"author": {"data": {"type": "authors", "id": "1"}}}}
+	],
+	"links": {"next": "http://example.com/novels?page=2"},
+	"meta": {"total": 2},
+	"included": [
+		{"type": "authors", "id": "1", "attributes": {"name": "Frank Herbert"}}
+	]
+}`
+
+func TestUnmarshalManyStream(t *testing.T) {
+	var titles []string
+	payload, err := UnmarshalManyStream(strings.NewReader(streamIncludedLast), reflect.TypeOf(new(Novel)), func(model interface{}) error {
+		titles = append(titles, model.(*Novel).Title)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(titles, []string{"Dune", "Dune Messiah"}) {
+		t.Fatalf("Unexpected titles %v", titles)
+	}
+	if payload.Data != nil {
+		t.Fatalf("Expected no data in the payload, got %v", payload.Data)
+	}
+	if (*payload.Links)["next"] != "http://example.com/novels?page=2" || (*payload.Meta)["total"] != float64(2) {
+		t.Fatalf("Unexpected links %v and meta %v", payload.Links, payload.Meta)
+	}
+	if len(payload.Included) != 1 {
+		t.Fatalf("Expected the included author, got %v", payload.Included)
+	}
+}
+
+func TestUnmarshalEach_includedPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		policy   IncludedPolicy
+		resolved bool
+		err      error
+	}{
+		{"ignore", IncludedIgnore, false, nil},
+		{"buffer", IncludedBuffer, true, nil},
+		{"reject", IncludedReject, false, ErrIncludedAfterData},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var novels []*Novel
+			_, err := UnmarshalEach(strings.NewReader(streamIncludedLast), func(novel *Novel) error {
+				novels = append(novels, novel)
+				return nil
+			}, StreamIncluded(tc.policy))
+
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Expected %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(novels) != 2 {
+				t.Fatalf("Expected 2 novels, got %d", len(novels))
+			}
+			for _, novel := range novels {
+				if novel.Author == nil || novel.Author.ID != "1" {
+					t.Fatalf("Unexpected author %+v", novel.Author)
+				}
+				if resolved := novel.Author.Name == "Frank Herbert"; resolved != tc.resolved {
+					t.Errorf("Expected the author to be resolved: %v, got %+v", tc.resolved, novel.Author)
+				}
+			}
+		})
+	}
+}
+
+func TestUnmarshalEach_includedFirst(t *testing.T) {
+	in := strings.NewReader(`{
+		"included": [{"type": "authors", "id": "1", "attributes": {"name": "Frank Herbert"}}],
+		"data": [
+			{"type": "novels", "id": "1", "relationships": {"author": {"data": {"type": "authors", "id": "1"}}}},
+			{"type": "novels", "id": "2", "relationships": {"author": {"data": {"type": "authors", "id": "1"}}}}
+		]
+	}`)
+
+	var authors []*Author
+	_, err := UnmarshalEach(in, func(novel *Novel) error {
+		authors = append(authors, novel.Author)
+		return nil
+	}, StreamIncluded(IncludedReject))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(authors) != 2 || authors[0].Name != "Frank Herbert" || authors[0] != authors[1] {
+		t.Fatalf("Expected both novels to share the included author, got %+v", authors)
+	}
+}
+
+func TestUnmarshalManyStream_boundedModels(t *testing.T) {
+	// Every other novel is by the included author, the others by authors
+	// that are only identified
+	doc := new(bytes.Buffer)
+	doc.WriteString(`{"included": [{"type": "authors", "id": "1", "attributes": {"name": "Frank Herbert"}}], "data": [`)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			doc.WriteString(",")
+		}
+		author := 1
+		if i%2 == 1 {
+			author = i + 1
+		}
+		fmt.Fprintf(doc, `{"type": "novels", "id": "%d", "relationships": {"author": {"data": {"type": "authors", "id": "%d"}}}}`, i+1, author)
+	}
+	doc.WriteString(`]}`)
+
+	var shared *Author
+	s := newStreamDecoder(doc, reflect.TypeOf(new(Novel)), func(model interface{}) error {
+		novel := model.(*Novel)
+		if novel.Author.ID != "1" {
+			return nil
+		}
+		if shared == nil {
+			shared = novel.Author
+		} else if novel.Author != shared {
+			return errors.New("expected the included author to be shared")
+		}
+		return nil
+	}, newUnmarshalOptions(nil))
+	if err := s.decode(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the included author is remembered, whatever the number of novels
+	if len(s.state.models) != 1 {
+		t.Fatalf("Expected 1 remembered model, got %d", len(s.state.models))
+	}
+}
+
+func TestUnmarshalEach_reportUnresolved(t *testing.T) {
+	// The first novel links to the second before it is streamed, the second
+	// back to the first, and the third to a novel missing from the document
+	in := `{
+		"data": [
+			{"type": "novels", "id": "1", "relationships": {"sequel": {"data": {"type": "novels", "id": "2"}}}},
+			{"type": "novels", "id": "2", "relationships": {"sequel": {"data": {"type": "novels", "id": "1"}}}},
+			{"type": "novels", "id": "3", "relationships": {"sequel": {"data": {"type": "novels", "id": "4"}}}}
+		]
+	}`
+
+	var expected UnmarshalReport
+	if _, err := UnmarshalManyPayload(strings.NewReader(in), reflect.TypeOf(new(Novel)), Report(&expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	var report UnmarshalReport
+	_, err := UnmarshalEach(strings.NewReader(in), func(novel *Novel) error {
+		return nil
+	}, Report(&report))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unresolved := []ReportedResource{
+		{Pointer: "/data/2/relationships/sequel/data", Type: "novels", ID: "4"},
+	}
+	if !reflect.DeepEqual(expected.Unresolved, unresolved) {
+		t.Fatalf("Expected UnmarshalManyPayload to report %+v, got %+v", unresolved, expected.Unresolved)
+	}
+	if !reflect.DeepEqual(report.Unresolved, unresolved) {
+		t.Fatalf("Expected unresolved resources %+v, got %+v", unresolved, report.Unresolved)
+	}
+}
+
+func TestUnmarshalEach_callbackError(t *testing.T) {
+	stop := errors.New("stop")
+
+	count := 0
+	_, err := UnmarshalEach(strings.NewReader(streamIncludedLast), func(novel *Novel) error {
+		count++
+		return stop
+	})
+
+	if err != stop || count != 1 {
+		t.Fatalf("Expected to stop after the first novel, got %v after %d", err, count)
+	}
+}
+
+func TestUnmarshalEach_errors(t *testing.T) {
+	for _, tc := range []struct {
+		desc    string
+		in      string
+		opts    []UnmarshalOption
+		pointer string
+		cause   error
+	}{
+		{"not a collection", `{"data": {"type": "novels", "id": "1"}}`, nil, "/data", ErrExpectedSlice},
+		{"attribute", `{"data": [{"type": "novels", "id": "1"}, {"type": "novels", "id": "2", "attributes": {"title": 1}}]}`, nil, "/data/1/attributes/title", nil},
+		{"unknown member", `{"data": [], "extra": true}`, []UnmarshalOption{DisallowUnknownMembers()}, "/extra", ErrUnknownMember},
+		{"unknown included", `{"data": [], "included": [{"type": "blogs", "id": "1"}]}`, []UnmarshalOption{DisallowUnknownMembers()}, "/included/0/type", ErrUnknownType},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			_, err := UnmarshalEach(strings.NewReader(tc.in), func(novel *Novel) error { return nil }, tc.opts...)
+
+			var unmarshalErr *UnmarshalError
+			if !errors.As(err, &unmarshalErr) || unmarshalErr.Pointer != tc.pointer {
+				t.Fatalf("Expected an *UnmarshalError at %q, got %v", tc.pointer, err)
+			}
+			if tc.cause != nil && !errors.Is(err, tc.cause) {
+				t.Fatalf("Expected %v, got %v", tc.cause, err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalEach_collectErrors(t *testing.T) {
+	in := strings.NewReader(`{"data": [
+		{"type": "novels", "id": "1", "attributes": {"title": 1}},
+		{"type": "novels", "id": "2", "attributes": {"title": 2}}
+	]}`)
+
+	count := 0
+	_, err := UnmarshalEach(in, func(novel *Novel) error {
+		count++
+		return nil
+	}, CollectErrors())
+
+	var errs UnmarshalErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("Expected 2 errors, got %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("Expected both novels to be handed over, got %d", count)
+	}
+}
+
+func TestUnmarshalEach_unexpectedType(t *testing.T) {
+	if _, err := UnmarshalEach(strings.NewReader(`{"data": []}`), func(*string) error { return nil }); err != ErrUnexpectedType {
+		t.Fatalf("Expected %v, got %v", ErrUnexpectedType, err)
+	}
+}
+
+func TestStreamEncoder(t *testing.T) {
+	author := &Author{ID: "1", Name: "Frank Herbert"}
+	novels := []*Novel{
+		{ID: "1", Title: "Dune", Author: author},
+		{ID: "2", Title: "Dune Messiah", Author: author},
+	}
+
+	out := bytes.NewBuffer(nil)
+	enc := NewStreamEncoder(out)
+	for _, novel := range novels {
+		if err := enc.Encode(novel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enc.SetLinks(&Links{"next": "http://example.com/novels?page=2"})
+	enc.SetMeta(&Meta{"total": 2})
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bytes.NewBuffer(nil)
+	if err := MarshalPayload(expected, novels); err != nil {
+		t.Fatal(err)
+	}
+
+	var streamed, marshaled map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &streamed); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", out, err)
+	}
+	if err := json.Unmarshal(expected.Bytes(), &marshaled); err != nil {
+		t.Fatal(err)
+	}
+	marshaled["links"] = map[string]interface{}{"next": "http://example.com/novels?page=2"}
+	marshaled["meta"] = map[string]interface{}{"total": float64(2)}
+
+	if !reflect.DeepEqual(streamed, marshaled) {
+		t.Fatalf("Expected %v, got %v", marshaled, streamed)
+	}
+
+	if err := enc.Encode(novels[0]); err == nil {
+		t.Fatal("Expected an error encoding after Close")
+	}
+}
+
+func TestStreamEncoder_empty(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	if err := NewStreamEncoder(out).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := out.String(); actual != "{\"data\":[]}\n" {
+		t.Fatalf("Unexpected document %q", actual)
+	}
+}
+
+func TestStreamEncoder_errors(t *testing.T) {
+	enc := NewStreamEncoder(bytes.NewBuffer(nil))
+
+	if err := enc.Encode(Novel{ID: "1"}); err == nil {
+		t.Fatal("Expected an error encoding a struct value")
+	}
+	if err := enc.Close(); err == nil {
+		t.Fatal("Expected the encoding error to be returned by Close")
+	}
+}
+
+func TestMarshalChannel(t *testing.T) {
+	models := make(chan *Novel)
+	go func() {
+		defer close(models)
+		for _, id := range []string{"1", "2", "3"} {
+			models <- &Novel{ID: id}
+		}
+	}()
+
+	out := bytes.NewBuffer(nil)
+	if err := MarshalChannel(out, models); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	if _, err := UnmarshalEach(out, func(novel *Novel) error {
+		ids = append(ids, novel.ID)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3"}) {
+		t.Fatalf("Unexpected ids %v", ids)
+	}
+}
+
+func TestStreamEncoder_topLevelMembers(t *testing.T) {
+	out := bytes.NewBuffer(nil)
+	enc := NewStreamEncoder(out,
+		TopLevelLinks(&Links{"self": "http://example.com/novels", "next": "http://example.com/novels?page=1"}),
+		TopLevelMeta(&Meta{"source": "option"}),
+		TopLevelJSONAPI(&JSONAPIObject{Version: "1.0"}),
+	)
+	if err := enc.Encode(&Novel{ID: "1", Title: "Dune"}); err != nil {
+		t.Fatal(err)
+	}
+	enc.SetLinks(&Links{"next": "http://example.com/novels?page=2"})
+	enc.SetJSONAPI(&JSONAPIObject{Version: "1.1"})
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", out, err)
+	}
+
+	expectedLinks := map[string]interface{}{"self": "http://example.com/novels", "next": "http://example.com/novels?page=2"}
+	if !reflect.DeepEqual(doc["links"], expectedLinks) {
+		t.Fatalf("Expected links %v, got %v", expectedLinks, doc["links"])
+	}
+	if e, a := map[string]interface{}{"source": "option"}, doc["meta"]; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected meta %v, got %v", e, a)
+	}
+	if e, a := map[string]interface{}{"version": "1.1"}, doc["jsonapi"]; !reflect.DeepEqual(e, a) {
+		t.Fatalf("Expected jsonapi object %v, got %v", e, a)
+	}
+}